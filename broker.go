@@ -0,0 +1,252 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type Broker struct {
+	log    *logrus.Entry
+	config BrokerConf
+	ox     *Client
+	conn   *amqp.Connection
+	// the interval to wait before an event the CMDB failed to record is delivered again
+	interval time.Duration
+}
+
+// launch a consumer reading events from an AMQP 0-9-1 queue (e.g. RabbitMQ)
+func (c *Broker) Start(client *Client) {
+	// set the ox client
+	c.ox = client
+
+	// creates a channel to pass a SIGINT (ctrl+C) kernel signal with buffer capacity 1
+	stop := make(chan os.Signal, 1)
+
+	// sends any SIGINT signal to the stop channel
+	signal.Notify(stop, os.Interrupt)
+
+	var (
+		attempts int
+		interval time.Duration = 30 // the interval to wait for reconnection
+	)
+	for {
+		// connects to the broker and consumes events until the connection is lost
+		err := c.consume(stop)
+		if err == nil {
+			// the consumer was stopped
+			c.log.Println("Shutting down Broker consumer.")
+			return
+		}
+		attempts = attempts + 1
+		c.log.Warnf("Broker connection failed: %s. "+
+			"Attempt %d, waiting before attempting to connect again.", err, attempts)
+		select {
+		case <-stop:
+			c.log.Println("Shutting down Broker consumer.")
+			return
+		case <-time.After(interval * time.Second):
+		}
+	}
+}
+
+// the AMQP channel operations used by the consumer, so that the channel can be faked in tests
+type brokerChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+}
+
+// connects to the broker, declares the topology and consumes deliveries
+// returns nil if stopped or an error if the connection was lost
+func (c *Broker) consume(stop chan os.Signal) error {
+	err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer c.conn.Close()
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return c.consumeFrom(ch, c.conn.NotifyClose(make(chan *amqp.Error, 1)), stop)
+}
+
+// declares the topology and consumes the deliveries of the passed-in channel
+// returns nil if stopped or an error if the connection was closed
+func (c *Broker) consumeFrom(ch brokerChannel, closed chan *amqp.Error, stop chan os.Signal) error {
+	if c.interval == 0 {
+		c.interval = 30 * time.Second
+	}
+	err := c.declare(ch)
+	if err != nil {
+		return err
+	}
+
+	// limits the number of unacknowledged deliveries
+	if c.config.Prefetch > 0 {
+		err = ch.Qos(c.config.Prefetch, 0, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	// consumes with manual acknowledgement so that events are only removed
+	// from the queue once the CMDB has been updated
+	deliveries, err := ch.Consume(c.config.Queue, "oxkube", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	c.log.Println(fmt.Sprintf("OxKube consuming from queue '%s'", c.config.Queue))
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case amqpErr := <-closed:
+			if amqpErr == nil {
+				return errors.New("connection closed")
+			}
+			return amqpErr
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("delivery channel closed")
+			}
+			if !c.handle(d) {
+				// waits before consuming the requeued event again so that
+				// the consumer does not hot loop whilst the CMDB is down
+				select {
+				case <-stop:
+					return nil
+				case <-time.After(c.interval):
+				}
+			}
+		}
+	}
+}
+
+// processes a single delivery and acknowledges it accordingly
+// returns false if the event was requeued as the CMDB failed to record it
+func (c *Broker) handle(d amqp.Delivery) bool {
+	c.log.Tracef("event: %s", describe(d.Body))
+
+	// a malformed event will never be processed so it is rejected without requeuing
+	if !gjson.ValidBytes(d.Body) {
+		c.log.Errorf("Discarding invalid event of %d bytes.", len(d.Body))
+		if err := d.Nack(false, false); err != nil {
+			c.log.Error(err)
+		}
+		return true
+	}
+
+	result, err := c.ox.process(d.Body)
+	if check(result, err) {
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		} else {
+			msg = result.Message
+		}
+		c.log.Errorf("Error whilst processing event, requeuing: %s", msg)
+		// puts the event back in the queue so that it can be retried
+		if err := d.Nack(false, true); err != nil {
+			c.log.Error(err)
+		}
+		return false
+	}
+	if err := d.Ack(false); err != nil {
+		c.log.Error(err)
+	}
+	return true
+}
+
+// opens a connection to the broker, using TLS if enabled
+func (c *Broker) connect() error {
+	var err error
+	if c.config.TLS.Enabled {
+		var tlsConfig *tls.Config
+		tlsConfig, err = newTLSConfig(c.config.TLS)
+		if err != nil {
+			return err
+		}
+		c.conn, err = amqp.DialTLS(c.config.URL, tlsConfig)
+	} else {
+		c.conn, err = amqp.Dial(c.config.URL)
+	}
+	return err
+}
+
+// declares the exchange and queue, and binds them using the routing key
+func (c *Broker) declare(ch brokerChannel) error {
+	if len(c.config.Exchange) > 0 {
+		exchangeType := c.config.ExchangeType
+		if len(exchangeType) == 0 {
+			exchangeType = amqp.ExchangeTopic
+		}
+		err := ch.ExchangeDeclare(c.config.Exchange, exchangeType, true, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(c.config.Queue, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	if len(c.config.Exchange) > 0 {
+		return ch.QueueBind(c.config.Queue, c.config.RoutingKey, c.config.Exchange, false, nil)
+	}
+	return nil
+}
+
+// creates a TLS configuration from the passed-in settings
+func newTLSConfig(conf TLSConf) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if len(conf.CACert) > 0 {
+		ca, err := ioutil.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse CA certificate '%s'", conf.CACert)
+		}
+	}
+	if len(conf.Cert) > 0 && len(conf.Key) > 0 {
+		cert, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
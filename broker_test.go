@@ -0,0 +1,222 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a fake AMQP channel delivering the events put in its queue and requeuing the ones nacked with requeue
+type fakeChannel struct {
+	lock       sync.Mutex
+	queue      chan amqp.Delivery
+	declared   []string
+	prefetch   int
+	acked      []uint64
+	nacked     []uint64
+	rejected   []uint64
+	handled    []time.Time
+	deliveries map[uint64]amqp.Delivery
+}
+
+func newFakeChannel(events ...string) *fakeChannel {
+	ch := &fakeChannel{queue: make(chan amqp.Delivery, 10), deliveries: make(map[uint64]amqp.Delivery)}
+	for i, event := range events {
+		d := amqp.Delivery{Acknowledger: ch, DeliveryTag: uint64(i + 1), Body: []byte(event)}
+		ch.deliveries[d.DeliveryTag] = d
+		ch.queue <- d
+	}
+	return ch
+}
+
+func (f *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	f.declared = append(f.declared, "exchange "+name+" "+kind)
+	return nil
+}
+
+func (f *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	f.declared = append(f.declared, "queue "+name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (f *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	f.declared = append(f.declared, "bind "+name+" "+key+" "+exchange)
+	return nil
+}
+
+func (f *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	f.prefetch = prefetchCount
+	return nil
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	if autoAck {
+		return nil, errors.New("the deliveries must be acknowledged manually")
+	}
+	return f.queue, nil
+}
+
+func (f *fakeChannel) Ack(tag uint64, multiple bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.acked = append(f.acked, tag)
+	f.handled = append(f.handled, time.Now())
+	return nil
+}
+
+func (f *fakeChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.handled = append(f.handled, time.Now())
+	if !requeue {
+		f.rejected = append(f.rejected, tag)
+		return nil
+	}
+	f.nacked = append(f.nacked, tag)
+	f.queue <- f.deliveries[tag]
+	return nil
+}
+
+func (f *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
+
+// gets the number of deliveries acknowledged, positively or not
+func (f *fakeChannel) count() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.handled)
+}
+
+// consumes from the fake channel recording in the fake CMDB until the condition is met or times out
+func runBroker(t *testing.T, ch *fakeChannel, onix *fakeOnix, interval time.Duration, until func() bool) {
+	srv := httptest.NewServer(onix)
+	defer srv.Close()
+
+	log := logrus.NewEntry(logrus.New())
+	consumer := &Broker{
+		log: log,
+		config: BrokerConf{
+			Queue:      "sentinel",
+			Exchange:   "k8s",
+			RoutingKey: "#",
+			Prefetch:   5,
+		},
+		ox:       &Client{Log: log, Config: &Config{Onix: Onix{URL: srv.URL}}},
+		interval: interval,
+	}
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.consumeFrom(ch, make(chan *amqp.Error), stop)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for !until() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Fatalf("consumer failed: %s", err)
+	}
+}
+
+func TestBrokerDeclaresTheTopology(t *testing.T) {
+	ch := newFakeChannel()
+	runBroker(t, ch, &fakeOnix{}, time.Millisecond, func() bool { return true })
+
+	expected := []string{"exchange k8s topic", "queue sentinel", "bind sentinel # k8s"}
+	if len(ch.declared) != len(expected) {
+		t.Fatalf("expected %v to be declared, got %v", expected, ch.declared)
+	}
+	for i := range expected {
+		if ch.declared[i] != expected[i] {
+			t.Errorf("expected %s to be declared, got %s", expected[i], ch.declared[i])
+		}
+	}
+	if ch.prefetch != 5 {
+		t.Errorf("expected a prefetch of 5 deliveries, got %d", ch.prefetch)
+	}
+}
+
+func TestBrokerAcksEventsAfterCMDBWrites(t *testing.T) {
+	ch := newFakeChannel(string(nsEvent("ns1")), string(nsEvent("ns2")))
+	// the first write to the CMDB fails so the first event has to be requeued
+	onix := &fakeOnix{failures: 1}
+
+	runBroker(t, ch, onix, 10*time.Millisecond, func() bool { return ch.count() >= 3 })
+
+	// the first event is requeued behind the second one
+	if len(ch.nacked) != 1 || ch.nacked[0] != 1 {
+		t.Errorf("expected the first event to be requeued, got %v", ch.nacked)
+	}
+	if len(ch.acked) != 2 || ch.acked[0] != 2 || ch.acked[1] != 1 {
+		t.Errorf("expected both events to be acknowledged once recorded, got %v", ch.acked)
+	}
+	// each namespace event requires three writes (cluster, namespace and link) plus the failed one
+	if onix.count() != 7 {
+		t.Errorf("expected 7 CMDB writes, got %d", onix.count())
+	}
+}
+
+func TestBrokerWaitsBeforeConsumingRequeuedEvents(t *testing.T) {
+	ch := newFakeChannel(string(nsEvent("ns1")))
+	// the CMDB never accepts the event
+	onix := &fakeOnix{failures: 1 << 30}
+	interval := 50 * time.Millisecond
+
+	runBroker(t, ch, onix, interval, func() bool { return ch.count() >= 3 })
+
+	if len(ch.acked) > 0 {
+		t.Errorf("expected no event to be acknowledged, got %v", ch.acked)
+	}
+	for i := 1; i < len(ch.handled); i++ {
+		if gap := ch.handled[i].Sub(ch.handled[i-1]); gap < interval {
+			t.Errorf("expected the requeued event to be consumed after %s, got %s", interval, gap)
+		}
+	}
+}
+
+func TestBrokerDiscardsInvalidEvents(t *testing.T) {
+	ch := newFakeChannel("{not json", string(nsEvent("ns1")))
+	onix := &fakeOnix{}
+
+	runBroker(t, ch, onix, time.Hour, func() bool { return ch.count() >= 2 })
+
+	if len(ch.rejected) != 1 || ch.rejected[0] != 1 {
+		t.Errorf("expected the invalid event to be rejected without requeuing, got %v", ch.rejected)
+	}
+	if len(ch.acked) != 1 || ch.acked[0] != 2 {
+		t.Errorf("expected the valid event to be acknowledged without waiting, got %v", ch.acked)
+	}
+}
+
+func TestBrokerStopsWhenTheConnectionIsClosed(t *testing.T) {
+	consumer := &Broker{log: logrus.NewEntry(logrus.New()), config: BrokerConf{Queue: "sentinel"}}
+	closed := make(chan *amqp.Error, 1)
+	closed <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "shutdown"}
+
+	err := consumer.consumeFrom(newFakeChannel(), closed, make(chan os.Signal))
+	if err == nil {
+		t.Errorf("expected an error when the connection is closed")
+	}
+}
@@ -28,8 +28,10 @@ const (
 	Key         = "Change.name"
 	Created     = "Object.metadata.creationTimestamp"
 	SpecInfo    = "Object.spec"
+	StatusInfo  = "Object.status"
 	Annotations = "Object.metadata.annotations"
 	Labels      = "Object.metadata.labels"
+	Owners      = "Object.metadata.ownerReferences"
 	Cluster     = "Change.host"
 	Namespace   = "Change.namespace"
 )
@@ -40,6 +42,32 @@ const (
 	ResourceQuotaNameTag         = "rq"
 	ReplicationControllerNameTag = "rc"
 	PersistentVolumeClaimNameTag = "pvc"
+	IngressNameTag               = "ing"
+	RouteNameTag                 = "route"
+	DeploymentNameTag            = "deploy"
+	ReplicaSetNameTag            = "rs"
+	StatefulSetNameTag           = "sts"
+	DaemonSetNameTag             = "ds"
+	CronJobNameTag               = "cj"
+	JobNameTag                   = "job"
+	NodeNameTag                  = "node"
+	PersistentVolumeNameTag      = "pv"
+	StorageClassNameTag          = "sc"
+	ConfigMapNameTag             = "cm"
+	SecretNameTag                = "secret"
+	ServiceAccountNameTag        = "sa"
+	RoleNameTag                  = "role"
+	RoleBindingNameTag           = "rb"
+	ClusterRoleNameTag           = "crole"
+	ClusterRoleBindingNameTag    = "crb"
+	NetworkPolicyNameTag         = "netpol"
+	AutoscalerNameTag            = "hpa"
+	PodDisruptionBudgetNameTag   = "pdb"
+	LimitRangeNameTag            = "lr"
+	EndpointsNameTag             = "ep"
+	EndpointSliceNameTag         = "eps"
+	ContainerNameTag             = "container"
+	ImageNameTag                 = "img"
 )
 
 type Client struct {
@@ -55,11 +83,34 @@ const (
 	K8SCluster               = "K8S_CL"
 	K8SNamespace             = "K8S_NS"
 	K8SResourceQuota         = "K8S_RQ"
+	K8SLimitRange            = "K8S_LR"
+	K8SEndpoints             = "K8S_EP"
+	K8SContainer             = "K8S_CONTAINER"
+	K8SImage                 = "K8S_IMAGE"
 	K8SPod                   = "K8S_POD"
 	K8SService               = "K8S_SVC"
 	K8SIngress               = "K8S_INGRESS"
 	K8SReplicationController = "K8S_RC"
 	K8SPersistentVolumeClaim = "K8S_PVC"
+	K8SDeployment            = "K8S_DEPLOY"
+	K8SReplicaSet            = "K8S_RS"
+	K8SStatefulSet           = "K8S_STS"
+	K8SDaemonSet             = "K8S_DS"
+	K8SCronJob               = "K8S_CRONJOB"
+	K8SJob                   = "K8S_JOB"
+	K8SNode                  = "K8S_NODE"
+	K8SPersistentVolume      = "K8S_PV"
+	K8SStorageClass          = "K8S_SC"
+	K8SConfigMap             = "K8S_CM"
+	K8SSecret                = "K8S_SECRET"
+	K8SServiceAccount        = "K8S_SA"
+	K8SRole                  = "K8S_ROLE"
+	K8SRoleBinding           = "K8S_RB"
+	K8SClusterRole           = "K8S_CROLE"
+	K8SClusterRoleBinding    = "K8S_CRB"
+	K8SNetworkPolicy         = "K8S_NETPOL"
+	K8SAutoscaler            = "K8S_HPA"
+	K8SPodDisruptionBudget   = "K8S_PDB"
 	K8SLink                  = "K8S_LINK"
 )
 
@@ -94,7 +145,7 @@ func (c *Client) setAuthenticationToken() error {
 		c.Log.Tracef("Requesting bearer authentication token.")
 		c.Token, err = NewBearerToken(c.Config.Onix.TokeURI, c.Config.Onix.ClientId, c.Config.Onix.ClientSecret, c.Config.Onix.Username, c.Config.Onix.Password)
 		if err != nil {
-			c.Log.Errorf("Failed to authenticate with OpenId server.", err)
+			c.Log.Errorf("Failed to authenticate with OpenId server: %s.", err)
 		} else {
 			c.Log.Tracef("Bearer token acquired.")
 		}
@@ -199,6 +250,11 @@ func (c *Client) getResource(resourceName string, key string, filter map[string]
 	// if the response status is OK (200)
 	if resp.StatusCode == 200 {
 		// if no key was passed-in, then assumes a query
+		if len(key) == 0 && resourceName == "link" {
+			result := new(LinkList)
+			err = json.NewDecoder(resp.Body).Decode(result)
+			return result, err
+		}
 		if len(key) == 0 {
 			result := new(ResultList)
 			err = json.NewDecoder(resp.Body).Decode(result)
@@ -0,0 +1,250 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"time"
+)
+
+// the types of the items recorded for the K8S objects in a namespace
+var namespacedTypes = []K8SOBJ{
+	K8SPod,
+	K8SContainer,
+	K8SService,
+	K8SEndpoints,
+	K8SIngress,
+	K8SResourceQuota,
+	K8SLimitRange,
+	K8SPersistentVolumeClaim,
+	K8SReplicationController,
+	K8SDeployment,
+	K8SReplicaSet,
+	K8SStatefulSet,
+	K8SDaemonSet,
+	K8SCronJob,
+	K8SJob,
+	K8SConfigMap,
+	K8SSecret,
+	K8SServiceAccount,
+	K8SRole,
+	K8SRoleBinding,
+	K8SNetworkPolicy,
+	K8SAutoscaler,
+	K8SPodDisruptionBudget,
+}
+
+// the types of the items recorded for the K8S objects that do not belong to a namespace
+var clusterTypes = []K8SOBJ{
+	K8SNamespace,
+	K8SNode,
+	K8SPersistentVolume,
+	K8SStorageClass,
+	K8SClusterRole,
+	K8SClusterRoleBinding,
+}
+
+// the types of the items recorded for the K8S objects that can be owned by a controller
+var ownedTypes = []K8SOBJ{
+	K8SReplicaSet,
+	K8SPod,
+	K8SJob,
+}
+
+// delete a namespace and, if cascading is enabled, all the items left in it
+func (c *Client) deleteNamespace(event []byte) (*Result, error) {
+	key := NS(event)
+	if c.Config == nil || !c.Config.Cascade.Namespace {
+		return c.removeItem(key, event)
+	}
+	cluster := gjson.GetBytes(event, Cluster).String()
+	namespace := gjson.GetBytes(event, Namespace).String()
+	if len(namespace) == 0 {
+		namespace = gjson.GetBytes(event, Key).String()
+	}
+	for _, objType := range namespacedTypes {
+		items, err := c.getObjectsInNamespace(cluster, namespace, objType)
+		if err != nil {
+			c.Log.Errorf("Failed to get %s items in namespace %s: %s.", objType, namespace, err)
+			return nil, err
+		}
+		for _, item := range items {
+			result, err := c.deleteItem(&item, nil)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return c.deleteItemKey(key, event)
+}
+
+// delete a controller of the specified kind and, if cascading is enabled, all the items it owns
+func (c *Client) deleteController(event []byte, kind string) (*Result, error) {
+	key := itemKey(event, ownerKinds[kind].nameTag)
+	if c.Config == nil || !c.Config.Cascade.Controller {
+		return c.removeItem(key, event)
+	}
+	controller, err := c.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+	if controller == nil {
+		return c.removeItem(key, event)
+	}
+	return c.deleteOwner(controller, event)
+}
+
+// delete the passed-in owner after deleting the items whose owner reference points to it
+// and, in turn, the items owned by them
+func (c *Client) deleteOwner(owner *Item, event []byte) (*Result, error) {
+	cluster, ok := owner.Attribute["cluster"].(string)
+	if !ok {
+		return nil, fmt.Errorf("owner %s has no cluster", owner.Key)
+	}
+	namespace, ok := owner.Attribute["namespace"].(string)
+	if !ok {
+		return nil, fmt.Errorf("owner %s has no namespace", owner.Key)
+	}
+	for _, objType := range ownedTypes {
+		items, err := c.getObjectsInNamespace(cluster, namespace, objType)
+		if err != nil {
+			c.Log.Errorf("Failed to get %s items owned by %s: %s.", objType, owner.Key, err)
+			return nil, err
+		}
+		for _, item := range items {
+			if ownerKey(&item) != owner.Key {
+				continue
+			}
+			result, err := c.deleteOwner(&item, nil)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return c.deleteItem(owner, event)
+}
+
+// delete the passed-in item and its links, including the containers of a pod
+func (c *Client) deleteItem(item *Item, event []byte) (*Result, error) {
+	if item.Type == K8SPod {
+		for _, name := range podContainerNames(item) {
+			result, err := c.deleteItemKey(fmt.Sprintf("%s-%s-%s", item.Key, ContainerNameTag, name), nil)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return c.deleteItemKey(item.Key, event)
+}
+
+// delete the links starting or ending at the item with the specified key and then the item
+// if retirement is enabled the item is retired and its links are kept
+func (c *Client) deleteItemKey(key string, event []byte) (*Result, error) {
+	if c.retiring() {
+		return c.retireItem(key, event)
+	}
+	return c.purgeItem(key)
+}
+
+// delete the links starting or ending at the item with the specified key and then the item
+func (c *Client) purgeItem(key string) (*Result, error) {
+	for _, filter := range []string{"startItemKey", "endItemKey"} {
+		links, err := c.getLinks(filter, key)
+		if err != nil {
+			return nil, err
+		}
+		for linkKey := range links {
+			result, err := c.deleteResource("link", linkKey)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return c.deleteResource("item", key)
+}
+
+// delete the item with the specified key or, if retirement is enabled, retire it
+// keeping the final spec in the passed-in delete event
+func (c *Client) removeItem(key string, event []byte) (*Result, error) {
+	if c.retiring() {
+		return c.retireItem(key, event)
+	}
+	return c.deleteResource("item", key)
+}
+
+// checks if the items have to be retired instead of deleted
+func (c *Client) retiring() bool {
+	return c.Config != nil && c.Config.Retirement.Enabled
+}
+
+// updates the item with the specified key with a retired status, the time it was deleted
+// and the final spec in the passed-in delete event, if any
+func (c *Client) retireItem(key string, event []byte) (*Result, error) {
+	item, err := c.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+	// nothing to retire
+	if item == nil {
+		return &Result{}, nil
+	}
+	if item.Attribute == nil {
+		item.Attribute = MAP{}
+	}
+	deleted := time.Now().UTC()
+	if t := gjson.GetBytes(event, "Change.time").Time(); !t.IsZero() {
+		deleted = t.UTC()
+	}
+	item.Status = StatusRetired
+	item.Attribute["deleted"] = deleted.Format(time.RFC3339)
+	if spec := gjson.GetBytes(event, SpecInfo); spec.Exists() {
+		item.Meta = MAP{}
+		if err := json.Unmarshal([]byte(spec.Raw), &item.Meta); err != nil {
+			return nil, err
+		}
+	}
+	_, result, err := c.putResource(item, "item")
+	return result, err
+}
+
+// deletes the items retired for longer than the retention period
+// returns the number of items deleted
+func (c *Client) sweepRetired(retention time.Duration) (int, error) {
+	count := 0
+	for _, objType := range append(clusterTypes, namespacedTypes...) {
+		items, err := c.getRetiredItems(objType)
+		if err != nil {
+			c.Log.Errorf("Failed to get retired %s items: %s.", objType, err)
+			return count, err
+		}
+		for _, item := range items {
+			deleted, err := time.Parse(time.RFC3339, fmt.Sprint(item.Attribute["deleted"]))
+			if err != nil || time.Since(deleted) < retention {
+				continue
+			}
+			result, err := c.purgeItem(item.Key)
+			if check(result, err) {
+				if err == nil {
+					err = fmt.Errorf("failed to delete retired item %s: %s", item.Key, result.Message)
+				}
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,209 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// puts a namespace holding a deployment with a replica set and a pod, and a pod of a stateful set,
+// each linked to the namespace
+func putOwnedItems(onix *memOnix) {
+	ns := nsKey("test", "ns1")
+	onix.items[ns] = Item{Key: ns, Name: "ns1", Type: K8SNamespace, Attribute: MAP{"cluster": "test"}}
+	owned := []struct {
+		itemType  K8SOBJ
+		tag       string
+		name      string
+		ownerKind string
+		ownerName string
+	}{
+		{K8SDeployment, DeploymentNameTag, "web", "", ""},
+		{K8SReplicaSet, ReplicaSetNameTag, "web-1", "Deployment", "web"},
+		{K8SPod, PodNameTag, "web-1-a", "ReplicaSet", "web-1"},
+		{K8SPod, PodNameTag, "db-0", "StatefulSet", "db"},
+	}
+	for _, o := range owned {
+		key := ns + "-" + o.tag + "-" + o.name
+		onix.items[key] = Item{Key: key, Name: o.name, Type: string(o.itemType), Attribute: MAP{
+			"cluster": "test", "namespace": "ns1", "ownerKind": o.ownerKind, "ownerName": o.ownerName}}
+		onix.links[ns+"->"+key] = Link{Key: ns + "->" + key, StartItemKey: ns, EndItemKey: key}
+	}
+}
+
+func TestDeleteCascadesToOwnedItems(t *testing.T) {
+	cases := []struct {
+		name    string
+		cascade CascadeConf
+		event   []byte
+		kept    string
+	}{
+		{"controller", CascadeConf{Controller: true}, changeEvent("deployment", "delete", "ns1", "web"),
+			"k8s-test-ns-ns1,k8s-test-ns-ns1-pod-db-0"},
+		{"namespace", CascadeConf{Namespace: true, Controller: true}, changeEvent("namespace", "delete", "", "ns1"),
+			""},
+	}
+	for _, c := range cases {
+		onix := newMemOnix()
+		ox, stop := onix.start()
+		ox.Config.Cascade = c.cascade
+		putOwnedItems(onix)
+
+		result, err := ox.process(c.event)
+		stop()
+		if check(result, err) {
+			t.Fatalf("%s: failed to delete: %v %v", c.name, result, err)
+		}
+		var kept []string
+		for key := range onix.items {
+			kept = append(kept, key)
+		}
+		sort.Strings(kept)
+		if strings.Join(kept, ",") != c.kept {
+			t.Errorf("%s: expected the items %s to be kept, got %v", c.name, c.kept, kept)
+		}
+		for key, link := range onix.links {
+			if _, ok := onix.items[link.EndItemKey]; !ok {
+				t.Errorf("%s: expected link %s to be deleted with its item", c.name, key)
+			}
+		}
+	}
+}
+
+func TestDeleteOwnerOnlyQueriesOwnedTypes(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ox.Config.Cascade = CascadeConf{Controller: true}
+	putOwnedItems(onix)
+
+	result, err := ox.process(changeEvent("deployment", "delete", "ns1", "web"))
+	if check(result, err) {
+		t.Fatalf("failed to delete: %v %v", result, err)
+	}
+	if len(onix.types) == 0 {
+		t.Fatalf("expected the items owned by the deployment to be queried")
+	}
+	for _, queried := range onix.types {
+		owned := false
+		for _, objType := range ownedTypes {
+			owned = owned || queried == string(objType)
+		}
+		if !owned {
+			t.Errorf("expected only the types that can be owned to be queried, got %s", queried)
+		}
+	}
+}
+
+func TestDeleteOwnerRequiresTheClusterAndNamespace(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	owner := &Item{Key: "k8s-test-ns-ns1-deploy-web", Type: K8SDeployment, Attribute: MAP{"cluster": "test"}}
+	if _, err := ox.deleteOwner(owner, nil); err == nil {
+		t.Errorf("expected an error deleting an owner without a namespace")
+	}
+}
+
+func TestRetiredItemsAreRestoredWhenCreatedAgain(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ox.Config.Retirement = RetirementConf{Enabled: true}
+	key := nsKey("test", "ns1") + "-" + ConfigMapNameTag + "-app"
+	// a pod using the config map
+	pod := nsKey("test", "ns1") + "-" + PodNameTag + "-web"
+	onix.links[pod+"->"+key] = Link{Key: pod + "->" + key, StartItemKey: pod, EndItemKey: key}
+
+	steps := []struct {
+		event   []byte
+		retired bool
+	}{
+		{objectEvent("config_map", "app", `"data":{"a":"1"}`), false},
+		{changeEvent("config_map", "delete", "ns1", "app"), true},
+		{objectEvent("config_map", "app", `"data":{"a":"1"}`), false},
+	}
+	for i, step := range steps {
+		result, err := ox.process(step.event)
+		if check(result, err) {
+			t.Fatalf("step %d: failed to process the config map change: %v %v", i+1, result, err)
+		}
+		item, ok := onix.items[key]
+		if !ok {
+			t.Fatalf("step %d: expected the config map to be kept in the CMDB", i+1)
+		}
+		_, deleted := item.Attribute["deleted"]
+		if (item.Status == StatusRetired) != step.retired || deleted != step.retired {
+			t.Errorf("step %d: expected the config map retired to be %t, got status %d and attributes %v", i+1, step.retired, item.Status, item.Attribute)
+		}
+		if links := onix.linksTo(key); len(links) != 1 {
+			t.Errorf("step %d: expected the link to the config map to be kept, got %v", i+1, links)
+		}
+	}
+}
+
+func TestRetiredItemsDoNotExist(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ns := nsKey("test", "ns1")
+	onix.items[ns] = Item{Key: ns, Name: "ns1", Type: K8SNamespace, Attribute: MAP{"cluster": "test"}}
+	secret := ns + "-" + SecretNameTag + "-ca"
+	onix.items[secret] = Item{Key: secret, Name: "ca", Type: K8SSecret, Status: StatusRetired, Attribute: MAP{"cluster": "test", "namespace": "ns1"}}
+
+	if exists, err := ox.itemExists(secret); err != nil || exists {
+		t.Errorf("expected a retired item not to exist, got %t %v", exists, err)
+	}
+	if _, err := ox.linkIfExists(ns, secret); err != nil {
+		t.Fatalf("failed to link: %s", err)
+	}
+	if links := onix.linksTo(secret); len(links) > 0 {
+		t.Errorf("expected no link to a retired item, got %v", links)
+	}
+}
+
+func TestSweepDeletesItemsRetiredForLongerThanTheRetention(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ns := nsKey("test", "ns1")
+	onix.items[ns] = Item{Key: ns, Name: "ns1", Type: K8SNamespace, Attribute: MAP{"cluster": "test"}}
+	for name, age := range map[string]time.Duration{"old": 2 * time.Hour, "new": time.Minute} {
+		key := ns + "-" + ConfigMapNameTag + "-" + name
+		onix.items[key] = Item{Key: key, Name: name, Type: K8SConfigMap, Status: StatusRetired, Attribute: MAP{
+			"cluster": "test", "namespace": "ns1", "deleted": time.Now().Add(-age).UTC().Format(time.RFC3339)}}
+		onix.links[ns+"->"+key] = Link{Key: ns + "->" + key, StartItemKey: ns, EndItemKey: key}
+	}
+
+	count, err := ox.sweepRetired(time.Hour)
+	if err != nil || count != 1 {
+		t.Fatalf("expected a single item to be swept, got %d %v", count, err)
+	}
+	if _, ok := onix.items[ns+"-cm-old"]; ok || len(onix.linksTo(ns+"-cm-old")) > 0 {
+		t.Errorf("expected the item retired for longer than the retention to be deleted with its links")
+	}
+	if _, ok := onix.items[ns+"-cm-new"]; !ok {
+		t.Errorf("expected the item retired within the retention to be kept")
+	}
+	if _, ok := onix.items[ns]; !ok {
+		t.Errorf("expected the namespace to be kept")
+	}
+}
@@ -29,5 +29,126 @@ func (c *Client) getObjectsInNamespace(cluster string, namespace string, objType
 		return nil, err
 	}
 	// unwraps the response into a list of pod items
-	return podsObj.(*ResultList).Values, nil
+	pods, err := itemList(podsObj, objType)
+	if err != nil {
+		return nil, err
+	}
+	return current(pods), nil
+}
+
+// get all K8S objects of a specific type in the specified cluster with an attribute set to the passed-in value
+func (c *Client) getObjectsInCluster(cluster string, objType K8SOBJ, attr string, value string) ([]Item, error) {
+	filters := map[string]string{
+		"type":  objType.String(),
+		"attrs": fmt.Sprintf("cluster,%s|%s,%s", cluster, attr, value),
+	}
+	itemsObj, err := c.getResource("item", "", filters)
+
+	if err != nil {
+		return nil, err
+	}
+	items, err := itemList(itemsObj, objType)
+	if err != nil {
+		return nil, err
+	}
+	return current(items), nil
+}
+
+// unwraps the items of the passed-in type from the response to an item query
+// returns an error if the response is not a list of items (e.g. the resource was not found)
+func itemList(obj interface{}, objType K8SOBJ) ([]Item, error) {
+	list, ok := obj.(*ResultList)
+	if !ok || list == nil {
+		return nil, fmt.Errorf("failed to query %s items: unexpected response", objType)
+	}
+	return list.Values, nil
+}
+
+// get all K8S objects of a specific type in the specified cluster
+func (c *Client) getObjectsOfType(cluster string, objType K8SOBJ) ([]Item, error) {
+	filters := map[string]string{
+		"type":  objType.String(),
+		"attrs": fmt.Sprintf("cluster,%s", cluster),
+	}
+	itemsObj, err := c.getResource("item", "", filters)
+
+	if err != nil {
+		return nil, err
+	}
+	items, err := itemList(itemsObj, objType)
+	if err != nil {
+		return nil, err
+	}
+	return current(items), nil
+}
+
+// get all the retired K8S objects of a specific type
+func (c *Client) getRetiredItems(objType K8SOBJ) ([]Item, error) {
+	filters := map[string]string{
+		"type":   objType.String(),
+		"status": fmt.Sprintf("%d", StatusRetired),
+	}
+	itemsObj, err := c.getResource("item", "", filters)
+
+	if err != nil {
+		return nil, err
+	}
+	items, err := itemList(itemsObj, objType)
+	if err != nil {
+		return nil, err
+	}
+	var retired []Item
+	for _, item := range items {
+		if item.Status == StatusRetired {
+			retired = append(retired, item)
+		}
+	}
+	return retired, nil
+}
+
+// removes the retired items from the passed-in items
+func current(items []Item) []Item {
+	var result []Item
+	for _, item := range items {
+		if item.Status != StatusRetired {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// gets the item with the specified key, or nil if it does not exist in the CMDB
+func (c *Client) getItem(key string) (*Item, error) {
+	obj, err := c.getResource("item", key, nil)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	item := obj.(Item)
+	return &item, nil
+}
+
+// gets the links currently in the CMDB starting (startItemKey) or ending (endItemKey) at the specified item
+// returns the links by key
+func (c *Client) getLinks(filter string, itemKey string) (map[string]Link, error) {
+	linksObj, err := c.getResource("link", "", map[string]string{filter: itemKey})
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]Link)
+	if list, ok := linksObj.(*LinkList); ok {
+		for _, link := range list.Values {
+			links[link.Key] = link
+		}
+	}
+	return links, nil
+}
+
+// checks if an item with the specified key exists in the CMDB
+// a retired item is kept for the record only, so it does not exist
+func (c *Client) itemExists(key string) (bool, error) {
+	item, err := c.getItem(key)
+	if err != nil {
+		return false, err
+	}
+	return item != nil && item.Status != StatusRetired, nil
 }
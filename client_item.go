@@ -0,0 +1,443 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+package main
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"strings"
+)
+
+// the functions building the items of the kinds of K8S object (i.e. the value of Change.kind) recording
+// more than the information of all items, shared by the handlers and the reconciler so that the items
+// recorded and the items the CMDB is compared with are the same
+// the attributes read from the status of the object are prefixed with status (e.g. status.succeeded)
+var itemBuilders = map[string]func(event []byte) (*Item, error){
+	"node":                      nodeItem,
+	"persistent_volume":         persistentVolumeItem,
+	"storage_class":             storageClassItem,
+	"pod":                       podItem,
+	"endpoints":                 endpointsItem,
+	"endpoint_slice":            endpointSliceItem,
+	"stateful_set":              statefulSetItem,
+	"cron_job":                  cronJobItem,
+	"job":                       jobItem,
+	"persistent_volume_claim":   persistentVolumeClaimItem,
+	"config_map":                configMapItem,
+	"secret":                    secretItem,
+	"service_account":           serviceAccountItem,
+	"role":                      roleItem,
+	"cluster_role":              clusterRoleItem,
+	"role_binding":              roleBindingItem,
+	"cluster_role_binding":      clusterRoleBindingItem,
+	"network_policy":            networkPolicyItem,
+	"horizontal_pod_autoscaler": autoscalerItem,
+	"pod_disruption_budget":     podDisruptionBudgetItem,
+	"limit_range":               limitRangeItem,
+	"ingress":                   ingressItem,
+	"route":                     routeItem,
+}
+
+func nodeItem(event []byte) (*Item, error) {
+	node, err := item(event, K8SNode, NodeNameTag)
+	if err != nil {
+		return nil, err
+	}
+	status := gjson.GetBytes(event, StatusInfo)
+	for _, resource := range []string{"cpu", "memory", "pods", "ephemeral-storage"} {
+		node.Attribute[fmt.Sprintf("status.capacity.%s", resource)] = status.Get("capacity").Get(resource).String()
+		node.Attribute[fmt.Sprintf("status.allocatable.%s", resource)] = status.Get("allocatable").Get(resource).String()
+	}
+	for _, info := range []string{"kernelVersion", "kubeletVersion", "osImage", "containerRuntimeVersion", "architecture"} {
+		node.Attribute[fmt.Sprintf("status.nodeInfo.%s", info)] = status.Get("nodeInfo").Get(info).String()
+	}
+	node.Attribute["zone"] = firstLabel(event, "topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone")
+	node.Attribute["region"] = firstLabel(event, "topology.kubernetes.io/region", "failure-domain.beta.kubernetes.io/region")
+	// the conditions are recorded by the node status mapper
+	return node, nil
+}
+
+func persistentVolumeItem(event []byte) (*Item, error) {
+	pv, err := item(event, K8SPersistentVolume, PersistentVolumeNameTag)
+	if err != nil {
+		return nil, err
+	}
+	spec := gjson.GetBytes(event, SpecInfo)
+	var accessModes []string
+	for _, mode := range spec.Get("accessModes").Array() {
+		accessModes = append(accessModes, mode.String())
+	}
+	pv.Attribute["capacity"] = spec.Get("capacity.storage").String()
+	pv.Attribute["accessModes"] = strings.Join(accessModes, ",")
+	pv.Attribute["reclaimPolicy"] = spec.Get("persistentVolumeReclaimPolicy").String()
+	pv.Attribute["storageClassName"] = spec.Get("storageClassName").String()
+	pv.Attribute["volumeMode"] = spec.Get("volumeMode").String()
+	pv.Attribute["csiDriver"] = spec.Get("csi.driver").String()
+	pv.Attribute["volumeHandle"] = spec.Get("csi.volumeHandle").String()
+	pv.Attribute["status.phase"] = gjson.GetBytes(event, "Object.status.phase").String()
+	return pv, nil
+}
+
+func storageClassItem(event []byte) (*Item, error) {
+	sc, err := item(event, K8SStorageClass, StorageClassNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// storage classes do not have a spec, their settings are at the top level
+	object := gjson.GetBytes(event, "Object")
+	sc.Attribute["provisioner"] = object.Get("provisioner").String()
+	sc.Attribute["reclaimPolicy"] = object.Get("reclaimPolicy").String()
+	sc.Attribute["volumeBindingMode"] = object.Get("volumeBindingMode").String()
+	sc.Attribute["allowVolumeExpansion"] = strconv.FormatBool(object.Get("allowVolumeExpansion").Bool())
+	for key, value := range object.Get("parameters").Map() {
+		sc.Meta[key] = value.String()
+	}
+	return sc, nil
+}
+
+func podItem(event []byte) (*Item, error) {
+	pod, err := item(event, K8SPod, PodNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the labels apart from the attributes to match them with the selectors of other objects
+	pod.Meta["labels"] = objectLabels(event)
+
+	// records the node the pod is placed on
+	pod.Attribute["nodeName"] = gjson.GetBytes(event, "Object.spec.nodeName").String()
+
+	// records the config maps and secrets the pod uses
+	configMaps, secrets := podConfigRefs(event)
+	pod.Attribute["configMaps"] = strings.Join(configMaps, ",")
+	pod.Attribute["secrets"] = strings.Join(secrets, ",")
+
+	// records the names of the pod containers so that they can be deleted with the pod
+	var containers []string
+	for _, path := range []string{"Object.spec.initContainers", "Object.spec.containers"} {
+		for _, container := range gjson.GetBytes(event, path).Array() {
+			containers = appendUnique(containers, container.Get("name").String())
+		}
+	}
+	pod.Attribute["containers"] = strings.Join(containers, ",")
+
+	// records the service account the pod runs as
+	pod.Attribute["serviceAccount"] = gjson.GetBytes(event, "Object.spec.serviceAccountName").String()
+	return pod, nil
+}
+
+func endpointsItem(event []byte) (*Item, error) {
+	endpoints, err := item(event, K8SEndpoints, EndpointsNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// the endpoints are named after their service
+	ready, notReady := endpointsPods(event)
+	addEndpoints(endpoints, endpoints.Name, ready, notReady)
+	return endpoints, nil
+}
+
+func endpointSliceItem(event []byte) (*Item, error) {
+	slice, err := item(event, K8SEndpoints, EndpointSliceNameTag)
+	if err != nil {
+		return nil, err
+	}
+	slice.Attribute["addressType"] = gjson.GetBytes(event, "Object.addressType").String()
+	// a service can have many slices, labelled with the service name
+	ready, notReady := endpointSlicePods(event)
+	addEndpoints(slice, firstLabel(event, "kubernetes.io/service-name"), ready, notReady)
+	return slice, nil
+}
+
+// adds the service and the pods backing it to an endpoints or endpoint slice item
+func addEndpoints(endpoints *Item, service string, ready []string, notReady []string) {
+	endpoints.Attribute["service"] = service
+	endpoints.Attribute["readyPods"] = strings.Join(ready, ",")
+	endpoints.Attribute["notReadyPods"] = strings.Join(notReady, ",")
+}
+
+func statefulSetItem(event []byte) (*Item, error) {
+	sts, err := item(event, K8SStatefulSet, StatefulSetNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the names of the volume claim templates to find the claims generated from them
+	var templates []string
+	for _, template := range gjson.GetBytes(event, "Object.spec.volumeClaimTemplates").Array() {
+		templates = appendUnique(templates, template.Get("metadata.name").String())
+	}
+	sts.Attribute["volumeClaimTemplates"] = strings.Join(templates, ",")
+	return sts, nil
+}
+
+func cronJobItem(event []byte) (*Item, error) {
+	cj, err := item(event, K8SCronJob, CronJobNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the schedule and when it last ran
+	spec := gjson.GetBytes(event, SpecInfo)
+	status := gjson.GetBytes(event, StatusInfo)
+	cj.Attribute["schedule"] = spec.Get("schedule").String()
+	cj.Attribute["suspend"] = strconv.FormatBool(spec.Get("suspend").Bool())
+	cj.Attribute["status.lastScheduleTime"] = status.Get("lastScheduleTime").String()
+	cj.Attribute["status.lastSuccessfulTime"] = status.Get("lastSuccessfulTime").String()
+	return cj, nil
+}
+
+func jobItem(event []byte) (*Item, error) {
+	job, err := item(event, K8SJob, JobNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the outcome of the job run
+	spec := gjson.GetBytes(event, SpecInfo)
+	status := gjson.GetBytes(event, StatusInfo)
+	job.Attribute["completions"] = spec.Get("completions").String()
+	job.Attribute["parallelism"] = spec.Get("parallelism").String()
+	job.Attribute["status.active"] = strconv.FormatInt(status.Get("active").Int(), 10)
+	job.Attribute["status.succeeded"] = strconv.FormatInt(status.Get("succeeded").Int(), 10)
+	job.Attribute["status.failed"] = strconv.FormatInt(status.Get("failed").Int(), 10)
+	job.Attribute["status.startTime"] = status.Get("startTime").String()
+	job.Attribute["status.completionTime"] = status.Get("completionTime").String()
+	return job, nil
+}
+
+func persistentVolumeClaimItem(event []byte) (*Item, error) {
+	pvc, err := item(event, K8SPersistentVolumeClaim, PersistentVolumeClaimNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the volume the claim is bound to
+	pvc.Attribute["volumeName"] = gjson.GetBytes(event, "Object.spec.volumeName").String()
+	pvc.Attribute["status.phase"] = gjson.GetBytes(event, "Object.status.phase").String()
+	return pvc, nil
+}
+
+func configMapItem(event []byte) (*Item, error) {
+	cm, err := item(event, K8SConfigMap, ConfigMapNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records the names of the keys but not the data
+	keys := dataKeys(event, "Object.data", "Object.binaryData")
+	cm.Attribute["keys"] = strings.Join(keys, ",")
+	cm.Meta["keys"] = keys
+	return cm, nil
+}
+
+func secretItem(event []byte) (*Item, error) {
+	secret, err := item(event, K8SSecret, SecretNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// the last applied configuration annotation contains the secret values so it is never recorded
+	delete(secret.Attribute, "kubectl.kubernetes.io/last-applied-configuration")
+
+	// records the type and the names of the keys but never the values
+	keys := dataKeys(event, "Object.data", "Object.stringData")
+	secret.Attribute["type"] = gjson.GetBytes(event, "Object.type").String()
+	secret.Attribute["keys"] = strings.Join(keys, ",")
+	secret.Meta["keys"] = keys
+	return secret, nil
+}
+
+func serviceAccountItem(event []byte) (*Item, error) {
+	sa, err := item(event, K8SServiceAccount, ServiceAccountNameTag)
+	if err != nil {
+		return nil, err
+	}
+	var secrets, pullSecrets []string
+	for _, secret := range gjson.GetBytes(event, "Object.secrets").Array() {
+		secrets = appendUnique(secrets, secret.Get("name").String())
+	}
+	for _, secret := range gjson.GetBytes(event, "Object.imagePullSecrets").Array() {
+		pullSecrets = appendUnique(pullSecrets, secret.Get("name").String())
+	}
+	sa.Attribute["secrets"] = strings.Join(secrets, ",")
+	sa.Attribute["imagePullSecrets"] = strings.Join(pullSecrets, ",")
+	sa.Attribute["automountServiceAccountToken"] = gjson.GetBytes(event, "Object.automountServiceAccountToken").String()
+	return sa, nil
+}
+
+func roleItem(event []byte) (*Item, error) {
+	role, err := item(event, K8SRole, RoleNameTag)
+	if err != nil {
+		return nil, err
+	}
+	role.Meta["rules"] = flattenRules(event)
+	return role, nil
+}
+
+func clusterRoleItem(event []byte) (*Item, error) {
+	role, err := item(event, K8SClusterRole, ClusterRoleNameTag)
+	if err != nil {
+		return nil, err
+	}
+	role.Meta["rules"] = flattenRules(event)
+	if aggregation := gjson.GetBytes(event, "Object.aggregationRule"); aggregation.Exists() {
+		role.Meta["aggregationRule"] = aggregation.Value()
+	}
+	return role, nil
+}
+
+func roleBindingItem(event []byte) (*Item, error) {
+	binding, err := item(event, K8SRoleBinding, RoleBindingNameTag)
+	if err != nil {
+		return nil, err
+	}
+	addBinding(event, binding)
+	return binding, nil
+}
+
+func clusterRoleBindingItem(event []byte) (*Item, error) {
+	binding, err := item(event, K8SClusterRoleBinding, ClusterRoleBindingNameTag)
+	if err != nil {
+		return nil, err
+	}
+	addBinding(event, binding)
+	return binding, nil
+}
+
+// adds the role reference and subjects of a role or cluster role binding to the item
+func addBinding(event []byte, binding *Item) {
+	binding.Attribute["roleKind"] = gjson.GetBytes(event, "Object.roleRef.kind").String()
+	binding.Attribute["roleName"] = gjson.GetBytes(event, "Object.roleRef.name").String()
+	binding.Attribute["serviceAccounts"] = strings.Join(bindingServiceAccounts(event), ",")
+	binding.Meta["roleRef"] = gjson.GetBytes(event, "Object.roleRef").Value()
+	binding.Meta["subjects"] = gjson.GetBytes(event, "Object.subjects").Value()
+}
+
+func networkPolicyItem(event []byte) (*Item, error) {
+	policy, err := item(event, K8SNetworkPolicy, NetworkPolicyNameTag)
+	if err != nil {
+		return nil, err
+	}
+	spec := gjson.GetBytes(event, SpecInfo)
+	var policyTypes []string
+	for _, policyType := range spec.Get("policyTypes").Array() {
+		policyTypes = append(policyTypes, policyType.String())
+	}
+	policy.Attribute["policyTypes"] = strings.Join(policyTypes, ",")
+	policy.Attribute["ingressRules"] = strconv.Itoa(len(spec.Get("ingress").Array()))
+	policy.Attribute["egressRules"] = strconv.Itoa(len(spec.Get("egress").Array()))
+	return policy, nil
+}
+
+func autoscalerItem(event []byte) (*Item, error) {
+	hpa, err := item(event, K8SAutoscaler, AutoscalerNameTag)
+	if err != nil {
+		return nil, err
+	}
+	spec := gjson.GetBytes(event, SpecInfo)
+	hpa.Attribute["minReplicas"] = spec.Get("minReplicas").String()
+	hpa.Attribute["maxReplicas"] = spec.Get("maxReplicas").String()
+	hpa.Attribute["targetKind"] = spec.Get("scaleTargetRef.kind").String()
+	hpa.Attribute["targetName"] = spec.Get("scaleTargetRef.name").String()
+	hpa.Attribute["metrics"] = strings.Join(autoscalerMetrics(event), ",")
+	hpa.Attribute["status.currentReplicas"] = gjson.GetBytes(event, "Object.status.currentReplicas").String()
+	hpa.Attribute["status.desiredReplicas"] = gjson.GetBytes(event, "Object.status.desiredReplicas").String()
+	return hpa, nil
+}
+
+func podDisruptionBudgetItem(event []byte) (*Item, error) {
+	pdb, err := item(event, K8SPodDisruptionBudget, PodDisruptionBudgetNameTag)
+	if err != nil {
+		return nil, err
+	}
+	spec := gjson.GetBytes(event, SpecInfo)
+	status := gjson.GetBytes(event, StatusInfo)
+	pdb.Attribute["minAvailable"] = spec.Get("minAvailable").String()
+	pdb.Attribute["maxUnavailable"] = spec.Get("maxUnavailable").String()
+	pdb.Attribute["status.currentHealthy"] = status.Get("currentHealthy").String()
+	pdb.Attribute["status.desiredHealthy"] = status.Get("desiredHealthy").String()
+	pdb.Attribute["status.disruptionsAllowed"] = status.Get("disruptionsAllowed").String()
+	return pdb, nil
+}
+
+func limitRangeItem(event []byte) (*Item, error) {
+	lr, err := item(event, K8SLimitRange, LimitRangeNameTag)
+	if err != nil {
+		return nil, err
+	}
+	// records each limit as <type>.<limit>.<resource> (e.g. Container.default.cpu)
+	for _, limit := range gjson.GetBytes(event, "Object.spec.limits").Array() {
+		limitType := limit.Get("type").String()
+		for _, name := range []string{"default", "defaultRequest", "min", "max", "maxLimitRequestRatio"} {
+			for resource, value := range limit.Get(name).Map() {
+				lr.Attribute[fmt.Sprintf("%s.%s.%s", limitType, name, resource)] = value.String()
+			}
+		}
+	}
+	return lr, nil
+}
+
+func ingressItem(event []byte) (*Item, error) {
+	ing, err := item(event, K8SIngress, IngressNameTag)
+	if err != nil {
+		return nil, err
+	}
+	var hosts, paths, tlsHosts, services []string
+	spec := gjson.GetBytes(event, SpecInfo)
+	// the default backend (extensions/v1beta1 and networking.k8s.io/v1 formats)
+	services = appendBackend(services, spec.Get("backend"))
+	services = appendBackend(services, spec.Get("defaultBackend"))
+	for _, rule := range spec.Get("rules").Array() {
+		host := rule.Get("host").String()
+		hosts = appendUnique(hosts, host)
+		for _, path := range rule.Get("http.paths").Array() {
+			paths = append(paths, fmt.Sprintf("%s%s", host, path.Get("path").String()))
+			services = appendBackend(services, path.Get("backend"))
+		}
+	}
+	for _, tls := range spec.Get("tls").Array() {
+		for _, host := range tls.Get("hosts").Array() {
+			tlsHosts = appendUnique(tlsHosts, host.String())
+		}
+	}
+	ing.Attribute["hosts"] = strings.Join(hosts, ",")
+	ing.Attribute["paths"] = strings.Join(paths, ",")
+	ing.Attribute["tls"] = strconv.FormatBool(spec.Get("tls").Exists())
+	ing.Attribute["tlsHosts"] = strings.Join(tlsHosts, ",")
+	ing.Attribute["services"] = strings.Join(services, ",")
+	return ing, nil
+}
+
+func routeItem(event []byte) (*Item, error) {
+	route, err := item(event, K8SIngress, RouteNameTag)
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	spec := gjson.GetBytes(event, SpecInfo)
+	backends := append([]gjson.Result{spec.Get("to")}, spec.Get("alternateBackends").Array()...)
+	for _, backend := range backends {
+		if backend.Get("kind").String() == "Service" {
+			services = appendUnique(services, backend.Get("name").String())
+		}
+	}
+	host := spec.Get("host").String()
+	tls := spec.Get("tls")
+	route.Attribute["hosts"] = host
+	route.Attribute["paths"] = fmt.Sprintf("%s%s", host, spec.Get("path").String())
+	route.Attribute["tls"] = strconv.FormatBool(tls.Exists())
+	route.Attribute["tlsHosts"] = ""
+	if tls.Exists() {
+		route.Attribute["tlsHosts"] = host
+		route.Attribute["tlsTermination"] = tls.Get("termination").String()
+	}
+	route.Attribute["services"] = strings.Join(services, ",")
+	return route, nil
+}
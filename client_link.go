@@ -0,0 +1,659 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the item type and name tag of the K8S objects that can own other objects
+// by the kind used in metadata.ownerReferences
+var ownerKinds = map[string]struct {
+	itemType K8SOBJ
+	nameTag  string
+}{
+	"ReplicationController": {K8SReplicationController, ReplicationControllerNameTag},
+	"ReplicaSet":            {K8SReplicaSet, ReplicaSetNameTag},
+	"Deployment":            {K8SDeployment, DeploymentNameTag},
+	"StatefulSet":           {K8SStatefulSet, StatefulSetNameTag},
+	"DaemonSet":             {K8SDaemonSet, DaemonSetNameTag},
+	"CronJob":               {K8SCronJob, CronJobNameTag},
+	"Job":                   {K8SJob, JobNameTag},
+}
+
+// gets the key of the item owning the passed-in item
+// returns an empty key if the item has no owner or the owner kind is not recorded
+func ownerKey(item *Item) string {
+	kind, _ := item.Attribute["ownerKind"].(string)
+	name, _ := item.Attribute["ownerName"].(string)
+	cluster, _ := item.Attribute["cluster"].(string)
+	namespace, _ := item.Attribute["namespace"].(string)
+	owner, ok := ownerKinds[kind]
+	if !ok || len(name) == 0 || len(cluster) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s", nsKey(cluster, namespace), owner.nameTag, name)
+}
+
+// link the passed-in item with the controller owning it using its owner reference
+// removing the links to any controllers which no longer own it
+func (c *Client) linkToOwner(item *Item) (*Result, error) {
+	key := ownerKey(item)
+	links, err := c.getLinks("startItemKey", item.Key)
+	if err != nil {
+		return nil, err
+	}
+	ns := nsKey(item.Attribute["cluster"].(string), item.Attribute["namespace"].(string))
+	for linkKey, link := range links {
+		if link.EndItemKey != key && isOwnerKey(ns, link.EndItemKey) {
+			result, err := c.deleteResource("link", linkKey)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	if len(key) == 0 {
+		return &Result{}, nil
+	}
+	// the owner might not have been recorded yet, in which case
+	// the link is created when the owner is put
+	exists, err := c.itemExists(key)
+	if err != nil || !exists {
+		return &Result{}, err
+	}
+	_, result, err := c.putResource(c.getLink(item.Key, key), "link")
+	return result, err
+}
+
+// checks if the passed-in key is the key of a controller in the namespace
+func isOwnerKey(ns string, key string) bool {
+	for _, owner := range ownerKinds {
+		if strings.HasPrefix(key, fmt.Sprintf("%s-%s-", ns, owner.nameTag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// link the passed-in owner with any existing items of the specified type
+// in the namespace whose owner reference points to it, removing the links
+// to the items it no longer owns
+func (c *Client) linkOwnedItems(owner *Item, ownedType K8SOBJ) (*Result, error) {
+	owned, err := c.getObjectsInNamespace(
+		owner.Attribute["cluster"].(string),
+		owner.Attribute["namespace"].(string),
+		ownedType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := c.getLinks("endItemKey", owner.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range owned {
+		link := c.getLink(item.Key, owner.Key)
+		_, linked := links[link.KeyValue()]
+		if ownerKey(&item) == owner.Key {
+			_, result, err := c.putResource(link, "link")
+			if check(result, err) {
+				return result, err
+			}
+		} else if linked {
+			result, err := c.deleteResource("link", link.KeyValue())
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in stateful set with any existing PVCs in the namespace
+// generated from its volume claim templates
+func (c *Client) linkStatefulSetToPVCs(sts *Item) (*Result, error) {
+	pvcs, err := c.getObjectsInNamespace(
+		sts.Attribute["cluster"].(string),
+		sts.Attribute["namespace"].(string),
+		K8SPersistentVolumeClaim)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pvc := range pvcs {
+		if isTemplateClaim(sts, pvc.Name) {
+			_, result, err := c.putResource(c.getLink(sts.Key, pvc.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in PVC with any existing stateful set in the namespace
+// whose volume claim templates generated it
+func (c *Client) linkPVCToStatefulSets(pvc *Item) (*Result, error) {
+	statefulSets, err := c.getObjectsInNamespace(
+		pvc.Attribute["cluster"].(string),
+		pvc.Attribute["namespace"].(string),
+		K8SStatefulSet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sts := range statefulSets {
+		if isTemplateClaim(&sts, pvc.Name) {
+			_, result, err := c.putResource(c.getLink(sts.Key, pvc.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// checks if the claim name was generated from a volume claim template of the stateful set
+// the claims are named <template name>-<stateful set name>-<pod ordinal>
+func isTemplateClaim(sts *Item, claimName string) bool {
+	templates, _ := sts.Attribute["volumeClaimTemplates"].(string)
+	for _, template := range strings.Split(templates, ",") {
+		if len(template) == 0 {
+			continue
+		}
+		prefix := fmt.Sprintf("%s-%s-", template, sts.Name)
+		if strings.HasPrefix(claimName, prefix) {
+			if _, err := strconv.Atoi(strings.TrimPrefix(claimName, prefix)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// link the passed-in pod with the node it is placed on
+// removing the link to the node it was previously placed on, if it has been rescheduled
+func (c *Client) linkPodToNode(pod *Item, previous *Item) (*Result, error) {
+	cluster := pod.Attribute["cluster"].(string)
+	nodeName := pod.Attribute["nodeName"].(string)
+	if previous != nil {
+		previousNode, _ := previous.Attribute["nodeName"].(string)
+		if len(previousNode) > 0 && previousNode != nodeName {
+			link := c.getLink(pod.Key, clusterItemKey(cluster, NodeNameTag, previousNode))
+			_, _ = c.deleteResource("link", link.KeyValue())
+		}
+	}
+	// the pod has not been scheduled yet
+	if len(nodeName) == 0 {
+		return &Result{}, nil
+	}
+	nodeKey := clusterItemKey(cluster, NodeNameTag, nodeName)
+	// the node might not have been recorded yet, in which case
+	// the link is created when the node is put
+	exists, err := c.itemExists(nodeKey)
+	if err != nil || !exists {
+		return &Result{}, err
+	}
+	_, result, err := c.putResource(c.getLink(pod.Key, nodeKey), "link")
+	return result, err
+}
+
+// link the passed-in node with any existing pods placed on it
+func (c *Client) linkNodeToPods(node *Item) (*Result, error) {
+	pods, err := c.getObjectsInCluster(node.Attribute["cluster"].(string), K8SPod, "nodeName", node.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		_, result, err := c.putResource(c.getLink(pod.Key, node.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in item with an item that might not have been recorded yet or might have been retired,
+// in which case the link is created when the other item is put
+func (c *Client) linkIfExists(startKey string, endKey string) (*Result, error) {
+	exists, err := c.itemExists(startKey)
+	if err != nil || !exists {
+		return &Result{}, err
+	}
+	exists, err = c.itemExists(endKey)
+	if err != nil || !exists {
+		return &Result{}, err
+	}
+	_, result, err := c.putResource(c.getLink(startKey, endKey), "link")
+	return result, err
+}
+
+// link the passed-in pod with the objects of the specified type in the namespace
+// whose names are listed in the pod attribute
+// removing the links to the objects the pod no longer lists in the specified attribute
+func (c *Client) linkPodToNamed(pod *Item, previous *Item, objType K8SOBJ, tag string, attr string) (*Result, error) {
+	for _, name := range removedNames(attributeNames(previous, attr), attributeNames(pod, attr)) {
+		objKey := fmt.Sprintf("%s-%s-%s", nsKey(pod.Attribute["cluster"].(string), pod.Attribute["namespace"].(string)), tag, name)
+		_, _ = c.deleteResource("link", c.getLink(pod.Key, objKey).KeyValue())
+	}
+
+	objs, err := c.getObjectsInNamespace(
+		pod.Attribute["cluster"].(string),
+		pod.Attribute["namespace"].(string),
+		objType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names, _ := pod.Attribute[attr].(string)
+	for _, obj := range objs {
+		if contains(strings.Split(names, ","), obj.Name) {
+			_, result, err := c.putResource(c.getLink(pod.Key, obj.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in object with any existing pods in the namespace
+// listing its name in the specified pod attribute
+func (c *Client) linkNamedToPods(obj *Item, attr string) (*Result, error) {
+	pods, err := c.getObjectsInNamespace(
+		obj.Attribute["cluster"].(string),
+		obj.Attribute["namespace"].(string),
+		K8SPod)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods {
+		names, _ := pod.Attribute[attr].(string)
+		if contains(strings.Split(names, ","), obj.Name) {
+			_, result, err := c.putResource(c.getLink(pod.Key, obj.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// gets the key of the controller scaled by the passed-in autoscaler
+// returns an empty key if the target kind is not recorded
+func scaleTargetKey(hpa *Item) string {
+	kind, _ := hpa.Attribute["targetKind"].(string)
+	name, _ := hpa.Attribute["targetName"].(string)
+	target, ok := ownerKinds[kind]
+	if !ok || len(name) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s",
+		nsKey(hpa.Attribute["cluster"].(string), hpa.Attribute["namespace"].(string)),
+		target.nameTag,
+		name)
+}
+
+// link the passed-in controller with any existing autoscalers scaling it
+func (c *Client) linkAutoscalers(controller *Item) (*Result, error) {
+	autoscalers, err := c.getObjectsInCluster(controller.Attribute["cluster"].(string), K8SAutoscaler, "targetName", controller.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, hpa := range autoscalers {
+		if scaleTargetKey(&hpa) != controller.Key {
+			continue
+		}
+		_, result, err := c.putResource(c.getLink(hpa.Key, controller.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// gets the key of the role or cluster role referenced by a role binding in the specified namespace
+// cluster role bindings are passed an empty namespace
+func roleKey(cluster string, namespace string, kind string, name string) string {
+	if kind == "ClusterRole" {
+		return clusterItemKey(cluster, ClusterRoleNameTag, name)
+	}
+	return fmt.Sprintf("%s-%s-%s", nsKey(cluster, namespace), RoleNameTag, name)
+}
+
+// link the passed-in service account with any existing pods in the namespace running as it
+func (c *Client) linkServiceAccountToPods(sa *Item) (*Result, error) {
+	pods, err := c.getObjectsInCluster(sa.Attribute["cluster"].(string), K8SPod, "serviceAccount", sa.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if pod.Attribute["namespace"] != sa.Attribute["namespace"] {
+			continue
+		}
+		_, result, err := c.putResource(c.getLink(pod.Key, sa.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in service account with any existing role and cluster role bindings
+// having it as a subject
+func (c *Client) linkServiceAccountToBindings(sa *Item) (*Result, error) {
+	account := fmt.Sprintf("%s/%s", sa.Attribute["namespace"], sa.Name)
+	for _, bindingType := range []K8SOBJ{K8SRoleBinding, K8SClusterRoleBinding} {
+		bindings, err := c.getObjectsOfType(sa.Attribute["cluster"].(string), bindingType)
+		if err != nil {
+			return nil, err
+		}
+		for _, binding := range bindings {
+			accounts, _ := binding.Attribute["serviceAccounts"].(string)
+			if contains(strings.Split(accounts, ","), account) {
+				_, result, err := c.putResource(c.getLink(sa.Key, binding.Key), "link")
+				if check(result, err) {
+					return result, err
+				}
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in binding with its role and the service accounts it applies to, if they exist
+func (c *Client) linkBinding(binding *Item, previous *Item) (*Result, error) {
+	cluster := binding.Attribute["cluster"].(string)
+	accountKey := func(account string) string {
+		parts := strings.SplitN(account, "/", 2)
+		if len(parts) != 2 {
+			return ""
+		}
+		return fmt.Sprintf("%s-%s-%s", nsKey(cluster, parts[0]), ServiceAccountNameTag, parts[1])
+	}
+	key := bindingRoleKey(binding)
+
+	// removes the links to the subjects and role the binding no longer references
+	for _, account := range removedNames(attributeNames(previous, "serviceAccounts"), attributeNames(binding, "serviceAccounts")) {
+		if saKey := accountKey(account); len(saKey) > 0 {
+			_, _ = c.deleteResource("link", c.getLink(saKey, binding.Key).KeyValue())
+		}
+	}
+	if previous != nil {
+		if previousKey := bindingRoleKey(previous); previousKey != key {
+			_, _ = c.deleteResource("link", c.getLink(binding.Key, previousKey).KeyValue())
+		}
+	}
+
+	for _, account := range attributeNames(binding, "serviceAccounts") {
+		saKey := accountKey(account)
+		if len(saKey) == 0 {
+			continue
+		}
+		result, err := c.linkIfExists(saKey, binding.Key)
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return c.linkIfExists(binding.Key, key)
+}
+
+// gets the key of the role or cluster role referenced by the passed-in binding
+func bindingRoleKey(binding *Item) string {
+	namespace, _ := binding.Attribute["namespace"].(string)
+	kind, _ := binding.Attribute["roleKind"].(string)
+	name, _ := binding.Attribute["roleName"].(string)
+	return roleKey(binding.Attribute["cluster"].(string), namespace, kind, name)
+}
+
+// gets the key of the claim bound to the passed-in persistent volume
+// returns an empty key if the volume is not bound
+func volumeClaimKey(pv *Item) string {
+	if pv == nil {
+		return ""
+	}
+	claimRef, _ := pv.Meta["claimRef"].(map[string]interface{})
+	namespace, _ := claimRef["namespace"].(string)
+	name, _ := claimRef["name"].(string)
+	if len(name) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s", nsKey(pv.Attribute["cluster"].(string), namespace), PersistentVolumeClaimNameTag, name)
+}
+
+// gets the names in the comma separated value of the specified attribute of the passed-in item
+// returns no names if the item has not been recorded
+func attributeNames(item *Item, attr string) []string {
+	var names []string
+	if item == nil {
+		return names
+	}
+	value, _ := item.Attribute[attr].(string)
+	for _, name := range strings.Split(value, ",") {
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// gets the names in the previous list that are not in the current one
+func removedNames(previous []string, current []string) []string {
+	var removed []string
+	for _, name := range previous {
+		if len(name) > 0 && !contains(current, name) {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+// link the passed-in role or cluster role with any existing bindings referencing it
+func (c *Client) linkRoleToBindings(role *Item, kind string) (*Result, error) {
+	bindingTypes := []K8SOBJ{K8SRoleBinding}
+	if kind == "ClusterRole" {
+		bindingTypes = append(bindingTypes, K8SClusterRoleBinding)
+	}
+	cluster := role.Attribute["cluster"].(string)
+	for _, bindingType := range bindingTypes {
+		bindings, err := c.getObjectsInCluster(cluster, bindingType, "roleName", role.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, binding := range bindings {
+			namespace, _ := binding.Attribute["namespace"].(string)
+			if roleKey(cluster, namespace, binding.Attribute["roleKind"].(string), role.Name) != role.Key {
+				continue
+			}
+			_, result, err := c.putResource(c.getLink(binding.Key, role.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// gets the key of the service the passed-in endpoints belong to
+func endpointsServiceKey(endpoints *Item) string {
+	return fmt.Sprintf("%s-%s-%s",
+		nsKey(endpoints.Attribute["cluster"].(string), endpoints.Attribute["namespace"].(string)),
+		ServiceNameTag,
+		endpoints.Attribute["service"])
+}
+
+// link the passed-in service with any existing endpoints and the pods they record
+func (c *Client) linkServiceToEndpoints(service *Item) (*Result, error) {
+	endpoints, err := c.getObjectsInCluster(service.Attribute["cluster"].(string), K8SEndpoints, "service", service.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		if endpointsServiceKey(&ep) != service.Key {
+			continue
+		}
+		_, result, err := c.putResource(c.getLink(ep.Key, service.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+		result, err = c.linkEndpointPods(&ep, nil)
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// link the service of the passed-in endpoints with the pods backing it, recording if they are ready,
+// and remove the links to the pods in the previous version of the endpoints no longer backing it
+func (c *Client) linkEndpointPods(endpoints *Item, previous *Item) (*Result, error) {
+	serviceKey := endpointsServiceKey(endpoints)
+	// the service might not have been recorded yet, in which case
+	// its pods are linked when the endpoints change again
+	exists, err := c.itemExists(serviceKey)
+	if err != nil || !exists {
+		return &Result{}, err
+	}
+	ns := nsKey(endpoints.Attribute["cluster"].(string), endpoints.Attribute["namespace"].(string))
+	for attr, ready := range map[string]string{"readyPods": "true", "notReadyPods": "false"} {
+		pods, _ := endpoints.Attribute[attr].(string)
+		for _, pod := range strings.Split(pods, ",") {
+			if len(pod) == 0 {
+				continue
+			}
+			podKey := fmt.Sprintf("%s-%s-%s", ns, PodNameTag, pod)
+			exists, err := c.itemExists(podKey)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				continue
+			}
+			result, err := c.putEndpointPodLink(podKey, serviceKey, ready)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	if previous != nil {
+		return c.unlinkEndpointPods(previous, endpoints)
+	}
+	return &Result{}, nil
+}
+
+// link the passed-in pod with the services whose endpoints list it, which are the only source of
+// the links between services and pods, as the pod might be recorded after its endpoints
+func (c *Client) linkPodToEndpointServices(pod *Item) (*Result, error) {
+	endpoints, err := c.getObjectsInNamespace(pod.Attribute["cluster"].(string), pod.Attribute["namespace"].(string), K8SEndpoints)
+	if err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		for attr, ready := range map[string]string{"readyPods": "true", "notReadyPods": "false"} {
+			pods, _ := ep.Attribute[attr].(string)
+			if !contains(strings.Split(pods, ","), pod.Name) {
+				continue
+			}
+			// the service might not have been recorded yet, in which case
+			// its pods are linked when the service is recorded
+			serviceKey := endpointsServiceKey(&ep)
+			exists, err := c.itemExists(serviceKey)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				continue
+			}
+			result, err := c.putEndpointPodLink(pod.Key, serviceKey, ready)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// puts the link between a pod and the service it backs recording if the pod is ready
+func (c *Client) putEndpointPodLink(podKey string, serviceKey string, ready string) (*Result, error) {
+	link := c.getLink(podKey, serviceKey).(*Link)
+	link.Attribute = map[string]interface{}{"ready": ready}
+	_, result, err := c.putResource(link, "link")
+	return result, err
+}
+
+// remove the links between the service and the pods in the passed-in endpoints
+// which are not in the current version of the endpoints, if any, nor in any other
+// endpoints of the service (e.g. the other slices of a service with many slices)
+func (c *Client) unlinkEndpointPods(previous *Item, current *Item) (*Result, error) {
+	serviceKey := endpointsServiceKey(previous)
+	ns := nsKey(previous.Attribute["cluster"].(string), previous.Attribute["namespace"].(string))
+	listed, err := c.serviceEndpointsPodNames(previous.Attribute["cluster"].(string), previous.Attribute["service"].(string), serviceKey, previous.Key)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		listed = append(listed, endpointsPodNames(current)...)
+	}
+	for _, pod := range endpointsPodNames(previous) {
+		if contains(listed, pod) {
+			continue
+		}
+		link := c.getLink(fmt.Sprintf("%s-%s-%s", ns, PodNameTag, pod), serviceKey)
+		result, err := c.deleteResource("link", link.KeyValue())
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// gets the names of the pods in all the endpoints of the service with the passed-in name and key
+// but the endpoints with the excluded key, if any
+func (c *Client) serviceEndpointsPodNames(cluster string, service string, serviceKey string, excluded string) ([]string, error) {
+	items, err := c.getObjectsInCluster(cluster, K8SEndpoints, "service", service)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, ep := range items {
+		if ep.Key == excluded || endpointsServiceKey(&ep) != serviceKey {
+			continue
+		}
+		names = append(names, endpointsPodNames(&ep)...)
+	}
+	return names, nil
+}
+
+// gets the names of all the ready and not ready pods in the passed-in endpoints
+func endpointsPodNames(endpoints *Item) []string {
+	var names []string
+	for _, attr := range []string{"readyPods", "notReadyPods"} {
+		pods, _ := endpoints.Attribute[attr].(string)
+		for _, pod := range strings.Split(pods, ",") {
+			names = appendUnique(names, pod)
+		}
+	}
+	return names
+}
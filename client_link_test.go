@@ -0,0 +1,121 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// an endpoint slice event for the passed-in service listing the passed-in ready pods
+func sliceEvent(changeType string, name string, service string, pods ...string) []byte {
+	var endpoints []string
+	for _, pod := range pods {
+		endpoints = append(endpoints, fmt.Sprintf(`{"conditions":{"ready":true},"targetRef":{"kind":"Pod","name":"%s"}}`, pod))
+	}
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"endpoint_slice","type":"%s","name":"%s","namespace":"ns1","host":"test"},`+
+			`"Object":{"metadata":{"labels":{"kubernetes.io/service-name":"%s"}},"endpoints":[%s]}}`,
+		changeType, name, service, strings.Join(endpoints, ",")))
+}
+
+func TestEndpointSlicesKeepPodLinksListedByAnotherSlice(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	serviceKey := "k8s-test-ns-ns1-svc-web"
+	onix.items[serviceKey] = Item{Key: serviceKey, Type: K8SService}
+	for _, pod := range []string{"web-1", "web-2"} {
+		key := "k8s-test-ns-ns1-pod-" + pod
+		onix.items[key] = Item{Key: key, Type: K8SPod}
+	}
+	podLinks := func() string {
+		var pods []string
+		for _, key := range onix.linksTo(serviceKey) {
+			if strings.Contains(key, "-pod-") {
+				pods = append(pods, strings.TrimSuffix(strings.TrimPrefix(key, "k8s-test-ns-ns1-pod-"), "->"+serviceKey))
+			}
+		}
+		sort.Strings(pods)
+		return strings.Join(pods, ",")
+	}
+
+	steps := []struct {
+		event    []byte
+		expected string
+	}{
+		// both slices list web-1 whilst it moves from one slice to the other
+		{sliceEvent("create", "web-a", "web", "web-1", "web-2"), "web-1,web-2"},
+		{sliceEvent("create", "web-b", "web", "web-1"), "web-1,web-2"},
+		// web-1 is no longer in the first slice but is still in the second
+		{sliceEvent("update", "web-a", "web", "web-2"), "web-1,web-2"},
+		// deleting the second slice unlinks web-1 as no other slice lists it
+		{sliceEvent("delete", "web-b", "web", "web-1"), "web-2"},
+		{sliceEvent("delete", "web-a", "web", "web-2"), ""},
+	}
+	for i, step := range steps {
+		result, err := ox.process(step.event)
+		if check(result, err) {
+			t.Fatalf("step %d: failed to process event: %v %v", i, result, err)
+		}
+		if links := podLinks(); links != step.expected {
+			t.Errorf("step %d: expected pods linked to the service '%s', got '%s'", i, step.expected, links)
+		}
+	}
+}
+
+func TestEndpointsAreTheOnlySourceOfServiceToPodLinks(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	// a service selecting the pod labelled tier=web
+	service := []byte(`{"Change":{"kind":"service","type":"create","name":"web","namespace":"ns1","host":"test"},` +
+		`"Object":{"metadata":{},"spec":{"selector":{"tier":"web"}}}}`)
+	link := "k8s-test-ns-ns1-pod-web-1->k8s-test-ns-ns1-svc-web"
+	steps := []struct {
+		event []byte
+		ready string
+	}{
+		// the selector alone does not link the service with the pod
+		{service, "-"},
+		{selectedPodEvent, "-"},
+		{sliceEvent("create", "web-a", "web", "web-1"), "true"},
+		// the pod leaving the endpoints is not linked again when it changes
+		{sliceEvent("update", "web-a", "web"), "-"},
+		{selectedPodEvent, "-"},
+		// the pod recorded after the endpoints listing it is linked
+		{[]byte(`{"Change":{"kind":"pod","type":"delete","name":"web-1","namespace":"ns1","host":"test"},"Object":{"metadata":{}}}`), "-"},
+		{sliceEvent("update", "web-a", "web", "web-1"), "-"},
+		{selectedPodEvent, "true"},
+	}
+	for i, step := range steps {
+		if result, err := ox.process(step.event); check(result, err) {
+			t.Fatalf("step %d: failed to process event: %v %v", i, result, err)
+		}
+		// a missing link is reported as -
+		ready := "-"
+		if l, ok := onix.links[link]; ok {
+			ready, _ = l.Attribute["ready"].(string)
+		}
+		if ready != step.ready {
+			t.Errorf("step %d: expected the link ready attribute to be '%s', got '%s'", i, step.ready, ready)
+		}
+	}
+}
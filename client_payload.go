@@ -18,12 +18,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/tidwall/gjson"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // gets the kube meta-model for Onix
 func (c *Client) getModel() Payload {
-	return &Data{
+	data := &Data{
 		Models: []Model{
 			Model{
 				Key:         K8SModel,
@@ -38,6 +40,24 @@ func (c *Client) getModel() Payload {
 				Description: "An open-source system for automating deployment, scaling, and management of containerized applications.",
 				Model:       K8SModel,
 			},
+			ItemType{
+				Key:         K8SNode,
+				Name:        "Node",
+				Description: "A worker machine, virtual or physical, running the pods scheduled on it by the control plane.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SPersistentVolume,
+				Name:        "Persistent Volume",
+				Description: "A piece of storage in the cluster provisioned by an administrator or dynamically using a storage class.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SStorageClass,
+				Name:        "Storage Class",
+				Description: "Describes a class of storage offered by the cluster and the provisioner used to create its volumes.",
+				Model:       K8SModel,
+			},
 			ItemType{
 				Key:         K8SNamespace,
 				Name:        "Namespace",
@@ -50,12 +70,30 @@ func (c *Client) getModel() Payload {
 				Description: "A set of constraints that limit aggregate resource consumption per namespace.",
 				Model:       K8SModel,
 			},
+			ItemType{
+				Key:         K8SLimitRange,
+				Name:        "Limit Range",
+				Description: "A set of constraints and defaults for the resources requested by each container, pod or claim in a namespace.",
+				Model:       K8SModel,
+			},
 			ItemType{
 				Key:         K8SPod,
 				Name:        "Pod",
 				Description: "Encapsulates an application’s container (or, in some cases, multiple containers), storage resources, a unique network IP, and options that govern how the container(s) should run.",
 				Model:       K8SModel,
 			},
+			ItemType{
+				Key:         K8SContainer,
+				Name:        "Container",
+				Description: "A container or init container of a pod running an image.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SImage,
+				Name:        "Container Image",
+				Description: "A container image identified by its registry, repository, tag and digest.",
+				Model:       K8SModel,
+			},
 			ItemType{
 				Key:         K8SService,
 				Name:        "Service",
@@ -92,6 +130,108 @@ func (c *Client) getModel() Payload {
 				Description: "A claim to a piece of storage in the cluster made by a pod.",
 				Model:       K8SModel,
 			},
+			ItemType{
+				Key:         K8SConfigMap,
+				Name:        "Config Map",
+				Description: "Stores non-confidential configuration data as key-value pairs consumed by pods.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SSecret,
+				Name:        "Secret",
+				Description: "Stores sensitive data such as passwords, tokens or keys consumed by pods (only key names are recorded).",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SServiceAccount,
+				Name:        "Service Account",
+				Description: "Provides an identity for processes that run in a pod.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SRole,
+				Name:        "Role",
+				Description: "A set of permissions (rules) within a namespace.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SRoleBinding,
+				Name:        "Role Binding",
+				Description: "Grants the permissions defined in a role or cluster role to a set of subjects within a namespace.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SClusterRole,
+				Name:        "Cluster Role",
+				Description: "A set of permissions (rules) across the cluster or on cluster scoped resources.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SClusterRoleBinding,
+				Name:        "Cluster Role Binding",
+				Description: "Grants the permissions defined in a cluster role to a set of subjects across the cluster.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SNetworkPolicy,
+				Name:        "Network Policy",
+				Description: "Specifies how groups of pods are allowed to communicate with each other and other network endpoints.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SAutoscaler,
+				Name:        "Horizontal Pod Autoscaler",
+				Description: "Automatically scales the number of pods of a controller based on observed metrics.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SPodDisruptionBudget,
+				Name:        "Pod Disruption Budget",
+				Description: "Limits the number of pods of a replicated application that are down simultaneously from voluntary disruptions.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SEndpoints,
+				Name:        "Endpoints",
+				Description: "The ready and not ready pods backing a service, as recorded in an Endpoints or EndpointSlice object.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SDeployment,
+				Name:        "Deployment",
+				Description: "Provides declarative updates for pods by managing the replica sets that run them.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SReplicaSet,
+				Name:        "Replica Set",
+				Description: "Maintains a stable set of replica pods running at any given time, usually on behalf of a deployment.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SStatefulSet,
+				Name:        "Stateful Set",
+				Description: "Manages a set of pods with stable identities and persistent storage, such as databases.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SDaemonSet,
+				Name:        "Daemon Set",
+				Description: "Ensures that all (or some) nodes run a copy of a pod, such as log shippers or monitoring agents.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SCronJob,
+				Name:        "Cron Job",
+				Description: "Creates jobs on a repeating schedule.",
+				Model:       K8SModel,
+			},
+			ItemType{
+				Key:         K8SJob,
+				Name:        "Job",
+				Description: "Creates one or more pods and ensures that a specified number of them successfully terminate.",
+				Model:       K8SModel,
+			},
 		},
 		LinkTypes: []LinkType{
 			LinkType{
@@ -110,6 +250,54 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SCluster,
 				EndItemTypeKey:   K8SNamespace,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SCluster, K8SNode),
+				Name:             "K8S Cluster to Node Rule",
+				Description:      "A cluster contains one or more nodes.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SCluster,
+				EndItemTypeKey:   K8SNode,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SNode),
+				Name:             "K8S Pod to Node Rule",
+				Description:      "A pod is placed on a node.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SNode,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SCluster, K8SPersistentVolume),
+				Name:             "K8S Cluster to Persistent Volume Rule",
+				Description:      "A cluster provides one or more persistent volumes.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SCluster,
+				EndItemTypeKey:   K8SPersistentVolume,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SCluster, K8SStorageClass),
+				Name:             "K8S Cluster to Storage Class Rule",
+				Description:      "A cluster offers one or more storage classes.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SCluster,
+				EndItemTypeKey:   K8SStorageClass,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPersistentVolumeClaim, K8SPersistentVolume),
+				Name:             "K8S Persistent Volume Claim to Persistent Volume Rule",
+				Description:      "A persistent volume claim is bound to a persistent volume.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPersistentVolumeClaim,
+				EndItemTypeKey:   K8SPersistentVolume,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPersistentVolume, K8SStorageClass),
+				Name:             "K8S Persistent Volume to Storage Class Rule",
+				Description:      "A persistent volume is of a storage class.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPersistentVolume,
+				EndItemTypeKey:   K8SStorageClass,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SNamespace, K8SResourceQuota),
 				Name:             "K8S Namespace to Resource Quota Rule",
@@ -118,6 +306,14 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SNamespace,
 				EndItemTypeKey:   K8SResourceQuota,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SNamespace, K8SLimitRange),
+				Name:             "K8S Namespace to Limit Range Rule",
+				Description:      "A namespace constrains the resources of its containers, pods and claims with a limit range.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SNamespace,
+				EndItemTypeKey:   K8SLimitRange,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SNamespace, K8SPod),
 				Name:             "K8S Namespace to Pod Rule",
@@ -126,6 +322,22 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SNamespace,
 				EndItemTypeKey:   K8SPod,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SContainer),
+				Name:             "K8S Pod to Container Rule",
+				Description:      "A pod runs one or more containers.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SContainer,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SContainer, K8SImage),
+				Name:             "K8S Container to Image Rule",
+				Description:      "A container runs an image.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SContainer,
+				EndItemTypeKey:   K8SImage,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SPersistentVolumeClaim),
 				Name:             "K8S Pod to Persistent Volume Claim Rule",
@@ -134,6 +346,134 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SPod,
 				EndItemTypeKey:   K8SPersistentVolumeClaim,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SConfigMap),
+				Name:             "K8S Pod to Config Map Rule",
+				Description:      "A pod uses a config map via volumes or environment variables.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SConfigMap,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SSecret),
+				Name:             "K8S Pod to Secret Rule",
+				Description:      "A pod uses a secret via volumes, environment variables or image pull secrets.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SSecret,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SServiceAccount),
+				Name:             "K8S Pod to Service Account Rule",
+				Description:      "A pod runs as a service account.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SServiceAccount,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SServiceAccount, K8SRoleBinding),
+				Name:             "K8S Service Account to Role Binding Rule",
+				Description:      "A service account is a subject of a role binding.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SServiceAccount,
+				EndItemTypeKey:   K8SRoleBinding,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SServiceAccount, K8SClusterRoleBinding),
+				Name:             "K8S Service Account to Cluster Role Binding Rule",
+				Description:      "A service account is a subject of a cluster role binding.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SServiceAccount,
+				EndItemTypeKey:   K8SClusterRoleBinding,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SRoleBinding, K8SRole),
+				Name:             "K8S Role Binding to Role Rule",
+				Description:      "A role binding grants the permissions of a role.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SRoleBinding,
+				EndItemTypeKey:   K8SRole,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SRoleBinding, K8SClusterRole),
+				Name:             "K8S Role Binding to Cluster Role Rule",
+				Description:      "A role binding grants the permissions of a cluster role within its namespace.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SRoleBinding,
+				EndItemTypeKey:   K8SClusterRole,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SClusterRoleBinding, K8SClusterRole),
+				Name:             "K8S Cluster Role Binding to Cluster Role Rule",
+				Description:      "A cluster role binding grants the permissions of a cluster role.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SClusterRoleBinding,
+				EndItemTypeKey:   K8SClusterRole,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SCluster, K8SClusterRole),
+				Name:             "K8S Cluster to Cluster Role Rule",
+				Description:      "A cluster role is defined in a cluster.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SCluster,
+				EndItemTypeKey:   K8SClusterRole,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SCluster, K8SClusterRoleBinding),
+				Name:             "K8S Cluster to Cluster Role Binding Rule",
+				Description:      "A cluster role binding is defined in a cluster.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SCluster,
+				EndItemTypeKey:   K8SClusterRoleBinding,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SNetworkPolicy),
+				Name:             "K8S Pod to Network Policy Rule",
+				Description:      "A pod network traffic is governed by a network policy.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SNetworkPolicy,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SAutoscaler, K8SDeployment),
+				Name:             "K8S Horizontal Pod Autoscaler to Deployment Rule",
+				Description:      "A horizontal pod autoscaler scales a deployment.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SAutoscaler,
+				EndItemTypeKey:   K8SDeployment,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SAutoscaler, K8SReplicaSet),
+				Name:             "K8S Horizontal Pod Autoscaler to Replica Set Rule",
+				Description:      "A horizontal pod autoscaler scales a replica set.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SAutoscaler,
+				EndItemTypeKey:   K8SReplicaSet,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SAutoscaler, K8SStatefulSet),
+				Name:             "K8S Horizontal Pod Autoscaler to Stateful Set Rule",
+				Description:      "A horizontal pod autoscaler scales a stateful set.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SAutoscaler,
+				EndItemTypeKey:   K8SStatefulSet,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SAutoscaler, K8SReplicationController),
+				Name:             "K8S Horizontal Pod Autoscaler to Replication Controller Rule",
+				Description:      "A horizontal pod autoscaler scales a replication controller.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SAutoscaler,
+				EndItemTypeKey:   K8SReplicationController,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SPodDisruptionBudget),
+				Name:             "K8S Pod to Pod Disruption Budget Rule",
+				Description:      "A pod voluntary disruptions are limited by a pod disruption budget.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SPodDisruptionBudget,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SReplicationController),
 				Name:             "K8S Pod to Replication Controller Rule",
@@ -142,6 +482,62 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SPod,
 				EndItemTypeKey:   K8SReplicationController,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SReplicaSet),
+				Name:             "K8S Pod to Replica Set Rule",
+				Description:      "A pod is controlled by a replica set.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SReplicaSet,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SReplicaSet, K8SDeployment),
+				Name:             "K8S Replica Set to Deployment Rule",
+				Description:      "A replica set is controlled by a deployment.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SReplicaSet,
+				EndItemTypeKey:   K8SDeployment,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SStatefulSet),
+				Name:             "K8S Pod to Stateful Set Rule",
+				Description:      "A pod is controlled by a stateful set.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SStatefulSet,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SStatefulSet, K8SPersistentVolumeClaim),
+				Name:             "K8S Stateful Set to Persistent Volume Claim Rule",
+				Description:      "A stateful set makes persistent volume claims from its volume claim templates.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SStatefulSet,
+				EndItemTypeKey:   K8SPersistentVolumeClaim,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SDaemonSet),
+				Name:             "K8S Pod to Daemon Set Rule",
+				Description:      "A pod is controlled by a daemon set.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SDaemonSet,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SJob),
+				Name:             "K8S Pod to Job Rule",
+				Description:      "A pod is run by a job.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SPod,
+				EndItemTypeKey:   K8SJob,
+			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SJob, K8SCronJob),
+				Name:             "K8S Job to Cron Job Rule",
+				Description:      "A job is scheduled by a cron job.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SJob,
+				EndItemTypeKey:   K8SCronJob,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SPod, K8SService),
 				Name:             "K8S Pod to Service Rule",
@@ -150,6 +546,14 @@ func (c *Client) getModel() Payload {
 				StartItemTypeKey: K8SPod,
 				EndItemTypeKey:   K8SService,
 			},
+			LinkRule{
+				Key:              fmt.Sprintf("%s->%s", K8SEndpoints, K8SService),
+				Name:             "K8S Endpoints to Service Rule",
+				Description:      "Endpoints record the pods backing a service.",
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: K8SEndpoints,
+				EndItemTypeKey:   K8SService,
+			},
 			LinkRule{
 				Key:              fmt.Sprintf("%s->%s", K8SService, K8SIngress),
 				Name:             "K8S Service to Ingress Rule",
@@ -160,6 +564,11 @@ func (c *Client) getModel() Payload {
 			},
 		},
 	}
+	// adds the item types and link rules of the custom resources in the configuration
+	if c.Config != nil {
+		addCustomResourceTypes(data, c.Config.CustomResources)
+	}
+	return data
 }
 
 // generic link payload
@@ -203,18 +612,36 @@ func item(event []byte, iType string, oType string) (*Item, error) {
 		Attribute: MAP{},
 		Type:      iType,
 	}
+	// the labels and annotations are added first so that they cannot overwrite
+	// the attributes the keys of the item and its links depend on
+	addMap(event, item, Labels)
+	addMap(event, item, Annotations)
 	item.Attribute["cluster"] = cluster.String()
 	item.Attribute["namespace"] = namespace.String()
 	item.Attribute["created"] = created.String()
-	addMap(event, item, Labels)
-	addMap(event, item, Annotations)
-	err := json.Unmarshal([]byte(spec.String()), &item.Meta)
-	if err != nil {
-		return nil, err
+	// the version of the object used to find out if the item has drifted from it
+	item.Attribute["resourceVersion"] = gjson.GetBytes(event, "Object.metadata.resourceVersion").String()
+	addOwner(event, item)
+	addStatus(event, item)
+	// some objects (e.g. storage classes) do not have a spec
+	if spec.Exists() {
+		err := json.Unmarshal([]byte(spec.String()), &item.Meta)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return item, nil
 }
 
+// gets the labels of the K8S object in the event
+func objectLabels(event []byte) map[string]interface{} {
+	labels := make(map[string]interface{})
+	for key, value := range gjson.GetBytes(event, Labels).Map() {
+		labels[key] = value.String()
+	}
+	return labels
+}
+
 // adds the content of a map in the event to the item attributes
 func addMap(event []byte, item *Item, path string) {
 	mapObj := gjson.GetBytes(event, path).Map()
@@ -223,12 +650,309 @@ func addMap(event []byte, item *Item, path string) {
 	}
 }
 
+// gets the container items of a pod, including its init containers
+func containerItems(event []byte, pod *Item) ([]*Item, error) {
+	// gets the status of the containers including the image IDs the container runtime resolved the images to
+	statuses := make(map[string]gjson.Result)
+	for _, path := range []string{"Object.status.initContainerStatuses", "Object.status.containerStatuses"} {
+		for _, status := range gjson.GetBytes(event, path).Array() {
+			statuses[status.Get("name").String()] = status
+		}
+	}
+	var containers []*Item
+	for _, init := range []bool{true, false} {
+		path := "Object.spec.containers"
+		if init {
+			path = "Object.spec.initContainers"
+		}
+		for _, spec := range gjson.GetBytes(event, path).Array() {
+			name := spec.Get("name").String()
+			container := &Item{
+				Key:       fmt.Sprintf("%s-%s-%s", pod.Key, ContainerNameTag, name),
+				Name:      name,
+				Meta:      MAP{},
+				Attribute: MAP{},
+				Type:      K8SContainer,
+			}
+			container.Attribute["cluster"] = pod.Attribute["cluster"]
+			container.Attribute["namespace"] = pod.Attribute["namespace"]
+			container.Attribute["pod"] = pod.Name
+			container.Attribute["init"] = strconv.FormatBool(init)
+			container.Attribute["image"] = spec.Get("image").String()
+			container.Attribute["imageID"] = statuses[name].Get("imageID").String()
+			for _, resource := range []string{"cpu", "memory"} {
+				container.Attribute[fmt.Sprintf("requests.%s", resource)] = spec.Get("resources.requests").Get(resource).String()
+				container.Attribute[fmt.Sprintf("limits.%s", resource)] = spec.Get("resources.limits").Get(resource).String()
+			}
+			var ports, probes []string
+			for _, port := range spec.Get("ports").Array() {
+				ports = append(ports, fmt.Sprintf("%s/%s", port.Get("containerPort").String(), port.Get("protocol").String()))
+			}
+			for _, probe := range []string{"livenessProbe", "readinessProbe", "startupProbe"} {
+				if spec.Get(probe).Exists() {
+					probes = append(probes, probe)
+				}
+			}
+			container.Attribute["ports"] = strings.Join(ports, ",")
+			container.Attribute["probes"] = strings.Join(probes, ",")
+			containerStatus(statuses[name], container)
+			if err := json.Unmarshal([]byte(spec.Raw), &container.Meta); err != nil {
+				return nil, err
+			}
+			containers = append(containers, container)
+		}
+	}
+	return containers, nil
+}
+
+// gets the image item for a container image reference, which is not specific to a cluster
+// so that the same image used in different pods or clusters is recorded once
+// the image ID resolved by the container runtime is used to find the digest if not in the reference
+// the image is identified by its digest when known, as a tag can be moved to another image
+func imageItem(reference string, imageID string) *Item {
+	registry, repository, tag, digest := parseImage(reference)
+	if len(digest) == 0 {
+		if i := strings.Index(imageID, "sha256:"); i >= 0 {
+			digest = imageID[i:]
+		}
+	}
+	name := fmt.Sprintf("%s/%s@%s", registry, repository, digest)
+	if len(digest) == 0 {
+		name = fmt.Sprintf("%s/%s:%s", registry, repository, tag)
+	}
+	return &Item{
+		Key:  fmt.Sprintf("k8s-%s-%s", ImageNameTag, imageKeyReplacer.Replace(name)),
+		Name: name,
+		Meta: MAP{},
+		Attribute: MAP{
+			"registry":   registry,
+			"repository": repository,
+			"tag":        tag,
+			"digest":     digest,
+		},
+		Type: K8SImage,
+	}
+}
+
+// replaces the characters in an image reference that cannot be used in an item key
+var imageKeyReplacer = strings.NewReplacer("/", "-", ":", "-", "@", "-")
+
+// parses an image reference (e.g. quay.io/org/app:1.0@sha256:...) into its parts
+// using the docker hub defaults if the registry or tag are not specified
+func parseImage(reference string) (registry string, repository string, tag string, digest string) {
+	if i := strings.Index(reference, "@"); i >= 0 {
+		reference, digest = reference[:i], reference[i+1:]
+	}
+	// the tag follows the last colon after the last slash, otherwise the colon separates a registry port
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		reference, tag = reference[:i], reference[i+1:]
+	}
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry, repository = parts[0], parts[1]
+	} else {
+		registry, repository = "docker.io", reference
+	}
+	if registry == "docker.io" && !strings.Contains(repository, "/") {
+		repository = fmt.Sprintf("library/%s", repository)
+	}
+	if len(tag) == 0 && len(digest) == 0 {
+		tag = "latest"
+	}
+	return registry, repository, tag, digest
+}
+
+// gets the names of the config maps and secrets used by a pod via volumes,
+// environment variables or image pull secrets
+func podConfigRefs(event []byte) (configMaps []string, secrets []string) {
+	spec := gjson.GetBytes(event, SpecInfo)
+	for _, volume := range spec.Get("volumes").Array() {
+		configMaps = appendUnique(configMaps, volume.Get("configMap.name").String())
+		secrets = appendUnique(secrets, volume.Get("secret.secretName").String())
+		for _, source := range volume.Get("projected.sources").Array() {
+			configMaps = appendUnique(configMaps, source.Get("configMap.name").String())
+			secrets = appendUnique(secrets, source.Get("secret.name").String())
+		}
+	}
+	containers := append(spec.Get("initContainers").Array(), spec.Get("containers").Array()...)
+	for _, container := range containers {
+		for _, envFrom := range container.Get("envFrom").Array() {
+			configMaps = appendUnique(configMaps, envFrom.Get("configMapRef.name").String())
+			secrets = appendUnique(secrets, envFrom.Get("secretRef.name").String())
+		}
+		for _, env := range container.Get("env").Array() {
+			configMaps = appendUnique(configMaps, env.Get("valueFrom.configMapKeyRef.name").String())
+			secrets = appendUnique(secrets, env.Get("valueFrom.secretKeyRef.name").String())
+		}
+	}
+	for _, pullSecret := range spec.Get("imagePullSecrets").Array() {
+		secrets = appendUnique(secrets, pullSecret.Get("name").String())
+	}
+	return configMaps, secrets
+}
+
+// gets the sorted names of the keys in the passed-in maps of the K8S object
+func dataKeys(event []byte, paths ...string) []string {
+	var keys []string
+	for _, path := range paths {
+		for key := range gjson.GetBytes(event, path).Map() {
+			keys = appendUnique(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// flattens the rules of a role into one entry per verb and resource (or non-resource URL)
+// so that the permissions can be queried individually
+func flattenRules(event []byte) []MAP {
+	var permissions []MAP
+	for _, rule := range gjson.GetBytes(event, "Object.rules").Array() {
+		for _, verb := range rule.Get("verbs").Array() {
+			for _, url := range rule.Get("nonResourceURLs").Array() {
+				permissions = append(permissions, MAP{"verb": verb.String(), "nonResourceURL": url.String()})
+			}
+			for _, group := range rule.Get("apiGroups").Array() {
+				for _, resource := range rule.Get("resources").Array() {
+					names := rule.Get("resourceNames").Array()
+					if len(names) == 0 {
+						permissions = append(permissions, MAP{"verb": verb.String(), "apiGroup": group.String(), "resource": resource.String()})
+					}
+					for _, name := range names {
+						permissions = append(permissions, MAP{"verb": verb.String(), "apiGroup": group.String(), "resource": resource.String(), "resourceName": name.String()})
+					}
+				}
+			}
+		}
+	}
+	return permissions
+}
+
+// gets the service accounts a binding applies to as namespace/name
+func bindingServiceAccounts(event []byte) []string {
+	var accounts []string
+	for _, subject := range gjson.GetBytes(event, "Object.subjects").Array() {
+		if subject.Get("kind").String() != "ServiceAccount" {
+			continue
+		}
+		// the subject namespace defaults to the namespace of the role binding
+		namespace := subject.Get("namespace").String()
+		if len(namespace) == 0 {
+			namespace = gjson.GetBytes(event, Namespace).String()
+		}
+		accounts = appendUnique(accounts, fmt.Sprintf("%s/%s", namespace, subject.Get("name").String()))
+	}
+	return accounts
+}
+
+// gets the metrics used by an autoscaler as type:name
+func autoscalerMetrics(event []byte) []string {
+	var metrics []string
+	spec := gjson.GetBytes(event, SpecInfo)
+	for _, metric := range spec.Get("metrics").Array() {
+		metricType := metric.Get("type").String()
+		// the metric source is named after the type (e.g. Resource -> resource)
+		source := metric.Get(strings.ToLower(metricType[:1]) + metricType[1:])
+		name := source.Get("name").String()
+		if len(name) == 0 {
+			name = source.Get("metric.name").String()
+		}
+		metrics = appendUnique(metrics, fmt.Sprintf("%s:%s", metricType, name))
+	}
+	// autoscaling/v1 only supports a CPU utilisation target
+	if spec.Get("targetCPUUtilizationPercentage").Exists() {
+		metrics = appendUnique(metrics, "Resource:cpu")
+	}
+	return metrics
+}
+
+// gets the names of the ready and not ready pods in an Endpoints object
+func endpointsPods(event []byte) (ready []string, notReady []string) {
+	for _, subset := range gjson.GetBytes(event, "Object.subsets").Array() {
+		for _, address := range subset.Get("addresses").Array() {
+			ready = appendPod(ready, address.Get("targetRef"))
+		}
+		for _, address := range subset.Get("notReadyAddresses").Array() {
+			notReady = appendPod(notReady, address.Get("targetRef"))
+		}
+	}
+	return ready, notReady
+}
+
+// gets the names of the ready and not ready pods in an EndpointSlice object
+func endpointSlicePods(event []byte) (ready []string, notReady []string) {
+	for _, endpoint := range gjson.GetBytes(event, "Object.endpoints").Array() {
+		// an unknown ready condition is interpreted as ready
+		condition := endpoint.Get("conditions.ready")
+		if !condition.Exists() || condition.Bool() {
+			ready = appendPod(ready, endpoint.Get("targetRef"))
+		} else {
+			notReady = appendPod(notReady, endpoint.Get("targetRef"))
+		}
+	}
+	return ready, notReady
+}
+
+// appends the name of the pod an endpoint refers to, if it refers to a pod
+func appendPod(pods []string, targetRef gjson.Result) []string {
+	if targetRef.Get("kind").String() != "Pod" {
+		return pods
+	}
+	return appendUnique(pods, targetRef.Get("name").String())
+}
+
+// gets the value of the first of the passed-in labels defined in the K8S object
+func firstLabel(event []byte, labels ...string) string {
+	values := gjson.GetBytes(event, Labels).Map()
+	for _, label := range labels {
+		if value, ok := values[label]; ok {
+			return value.String()
+		}
+	}
+	return ""
+}
+
+// adds the kind and name of the controller owning the K8S object to the item attributes
+// if there is no controller, the first owner is used
+func addOwner(event []byte, item *Item) {
+	owners := gjson.GetBytes(event, Owners).Array()
+	if len(owners) == 0 {
+		return
+	}
+	owner := owners[0]
+	for _, ref := range owners {
+		if ref.Get("controller").Bool() {
+			owner = ref
+			break
+		}
+	}
+	item.Attribute["ownerKind"] = owner.Get("kind").String()
+	item.Attribute["ownerName"] = owner.Get("name").String()
+}
+
 // gets the unique key for a service
 func itemKey(event []byte, oType string) string {
 	key := gjson.GetBytes(event, Key).String()
+	if clusterScoped[oType] {
+		return clusterItemKey(gjson.GetBytes(event, Cluster).String(), oType, key)
+	}
 	return fmt.Sprintf("%s-%s-%s", NS(event), oType, key)
 }
 
+// the name tags of the K8S objects that do not belong to a namespace
+var clusterScoped = map[string]bool{
+	NodeNameTag:               true,
+	PersistentVolumeNameTag:   true,
+	StorageClassNameTag:       true,
+	ClusterRoleNameTag:        true,
+	ClusterRoleBindingNameTag: true,
+}
+
+// gets the unique key for an object that does not belong to a namespace
+func clusterItemKey(cluster string, oType string, name string) string {
+	return fmt.Sprintf("%s-%s-%s", clusterKey(cluster), oType, name)
+}
+
 func clusterKey(clusterKey string) string {
 	return fmt.Sprintf("k8s-%s", clusterKey)
 }
@@ -240,5 +964,10 @@ func NS(event []byte) string {
 	if len(namespace) == 0 {
 		namespace = gjson.GetBytes(event, Key).String()
 	}
+	return nsKey(cluster, namespace)
+}
+
+// gets the unique key for a namespace in a cluster
+func nsKey(cluster string, namespace string) string {
 	return fmt.Sprintf("%s-ns-%s", clusterKey(cluster), namespace)
 }
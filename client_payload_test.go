@@ -0,0 +1,78 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestImageItemIsKeyedByDigestWhenKnown(t *testing.T) {
+	digest := "sha256:0123abcd"
+	cases := []struct {
+		reference string
+		imageID   string
+		key       string
+		tag       string
+	}{
+		{"nginx", "", "k8s-img-docker.io-library-nginx-latest", "latest"},
+		{"quay.io/org/app:1.0", "", "k8s-img-quay.io-org-app-1.0", "1.0"},
+		{"quay.io/org/app:1.0@" + digest, "", "k8s-img-quay.io-org-app-sha256-0123abcd", "1.0"},
+		{"quay.io/org/app:1.0", "docker-pullable://quay.io/org/app@" + digest, "k8s-img-quay.io-org-app-sha256-0123abcd", "1.0"},
+		{"localhost:5000/app@" + digest, "", "k8s-img-localhost-5000-app-sha256-0123abcd", ""},
+	}
+	for _, c := range cases {
+		image := imageItem(c.reference, c.imageID)
+		if image.Key != c.key {
+			t.Errorf("%s: expected key %s, got %s", c.reference, c.key, image.Key)
+		}
+		if image.Attribute["tag"] != c.tag {
+			t.Errorf("%s: expected tag '%s', got '%s'", c.reference, c.tag, image.Attribute["tag"])
+		}
+	}
+}
+
+// a pod event with a container running the passed-in image resolved to the passed-in image ID
+func podEvent(changeType string, name string, image string, imageID string) []byte {
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"pod","type":"%s","name":"%s","namespace":"ns1","host":"test"},`+
+			`"Object":{"metadata":{},"spec":{"containers":[{"name":"app","image":"%s"}]},`+
+			`"status":{"containerStatuses":[{"name":"app","imageID":"%s"}]}}}`,
+		changeType, name, image, imageID))
+}
+
+func TestContainerIsRelinkedWhenImageDigestIsResolved(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	tagged := "k8s-img-quay.io-org-app-1.0"
+	resolved := "k8s-img-quay.io-org-app-sha256-0123abcd"
+	for i, event := range [][]byte{
+		podEvent("create", "web", "quay.io/org/app:1.0", ""),
+		podEvent("update", "web", "quay.io/org/app:1.0", "quay.io/org/app@sha256:0123abcd"),
+	} {
+		if result, err := ox.process(event); check(result, err) {
+			t.Fatalf("event %d: failed to process pod: %v %v", i, result, err)
+		}
+	}
+	if links := onix.linksTo(tagged); len(links) != 0 {
+		t.Errorf("expected the container to be unlinked from the tagged image, got %v", links)
+	}
+	if links := onix.linksTo(resolved); len(links) != 1 {
+		t.Errorf("expected the container to be linked to the image digest, got %v", links)
+	}
+}
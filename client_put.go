@@ -14,6 +14,13 @@
 */
 package main
 
+import (
+	"fmt"
+	"gatblau.org/oxkube/selector"
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
 // checks the kube model is defined in Onix
 func (c *Client) modelExists() (bool, error) {
 	model, err := c.getResource("model", K8SModel, nil)
@@ -23,16 +30,17 @@ func (c *Client) modelExists() (bool, error) {
 	return model != nil, nil
 }
 
-func (c *Client) putModel() *Result {
-	_, result, _ := c.putResource(c.getModel(), "data")
-	return result
+// puts the kube model in Onix, adding any item types and link rules missing from an existing model
+func (c *Client) putModel() (*Result, error) {
+	_, result, err := c.putResource(c.getModel(), "data")
+	return result, err
 }
 
 func (c *Client) putNamespace(event []byte) (*Result, error) {
 	// ensures the K8S cluster config item exists
 	clusterKey, result, err := c.putResource(c.getClusterItem(event), "item")
 
-	if result.Error {
+	if check(result, err) {
 		return result, err
 	}
 
@@ -45,7 +53,7 @@ func (c *Client) putNamespace(event []byte) (*Result, error) {
 	// push the item to the CMDB
 	namespaceKey, result, err := c.putResource(item, "item")
 
-	if result.Error {
+	if check(result, err) {
 		return result, err
 	}
 
@@ -54,13 +62,132 @@ func (c *Client) putNamespace(event []byte) (*Result, error) {
 	return result, err
 }
 
+func (c *Client) putNode(event []byte) (*Result, error) {
+	// gets the node item information
+	node, err := nodeItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get NODE information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB under the cluster
+	result, err := c.putInCluster(event, node)
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods placed on this node
+	_, _ = c.linkNodeToPods(node)
+
+	return result, err
+}
+
+func (c *Client) putPersistentVolume(event []byte) (*Result, error) {
+	// gets the persistent volume item information
+	pv, err := persistentVolumeItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get PERSISTENT VOLUME information: %s.", err)
+		return nil, err
+	}
+
+	// gets the volume as previously recorded to find out if its class or claim have changed
+	previous, err := c.getItem(pv.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// push the item to the CMDB under the cluster
+	result, err := c.putInCluster(event, pv)
+	if check(result, err) {
+		return result, err
+	}
+
+	cluster := pv.Attribute["cluster"].(string)
+	classKey := func(name string) string {
+		return clusterItemKey(cluster, StorageClassNameTag, name)
+	}
+
+	// link the volume with its storage class, removing the link to a previous one
+	for _, class := range removedNames(attributeNames(previous, "storageClassName"), attributeNames(pv, "storageClassName")) {
+		_, _ = c.deleteResource("link", c.getLink(pv.Key, classKey(class)).KeyValue())
+	}
+	if class := pv.Attribute["storageClassName"].(string); len(class) > 0 {
+		_, _ = c.linkIfExists(pv.Key, classKey(class))
+	}
+
+	// link the volume with the claim bound to it, removing the link to a previous one
+	claimKey := volumeClaimKey(pv)
+	if previousKey := volumeClaimKey(previous); len(previousKey) > 0 && previousKey != claimKey {
+		_, _ = c.deleteResource("link", c.getLink(previousKey, pv.Key).KeyValue())
+	}
+	if len(claimKey) > 0 {
+		_, _ = c.linkIfExists(claimKey, pv.Key)
+	}
+
+	return result, err
+}
+
+func (c *Client) putStorageClass(event []byte) (*Result, error) {
+	// gets the storage class item information
+	sc, err := storageClassItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get STORAGE CLASS information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB under the cluster
+	result, err := c.putInCluster(event, sc)
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are volumes of this storage class
+	volumes, err := c.getObjectsInCluster(sc.Attribute["cluster"].(string), K8SPersistentVolume, "storageClassName", sc.Name)
+	if err != nil {
+		return result, err
+	}
+	for _, pv := range volumes {
+		_, _, _ = c.putResource(c.getLink(pv.Key, sc.Key), "link")
+	}
+
+	return result, err
+}
+
+// push an item not belonging to a namespace to the CMDB and link it with its cluster
+func (c *Client) putInCluster(event []byte, item *Item) (*Result, error) {
+	// ensures the K8S cluster config item exists
+	clusterKey, result, err := c.putResource(c.getClusterItem(event), "item")
+
+	if check(result, err) {
+		return result, err
+	}
+
+	// push the item to the CMDB
+	itemKey, result, err := c.putResource(item, "item")
+
+	if check(result, err) {
+		return result, err
+	}
+
+	// push a link between the cluster and the item
+	_, result, err = c.putResource(c.getLink(clusterKey, itemKey), "link")
+	return result, err
+}
+
 func (c *Client) putPod(event []byte) (*Result, error) {
 	// gets the pod item information
-	pod, err := item(event, K8SPod, PodNameTag)
+	pod, err := podItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get POD information: %s.", err)
+		return nil, err
+	}
+
+	// gets the pod as previously recorded to find out if it has been placed on another node
+	previous, err := c.getItem(pod.Key)
 	if err != nil {
-		c.Log.Errorf("Failed to get POD information: %s. Event was: %s.", err, event)
 		return nil, err
 	}
+
 	// push the item to the CMDB
 	podKey, result, err := c.putResource(pod, "item")
 
@@ -71,18 +198,120 @@ func (c *Client) putPod(event []byte) (*Result, error) {
 	// ensure link between namespace and pod exist
 	_, result, err = c.putResource(c.getLink(NS(event), podKey), "link")
 
-	// link the pod with services
-	_, _ = c.linkPodToK8SObject(K8SService, pod)
+	// link the pod with the services whose endpoints list it
+	_, _ = c.linkPodToEndpointServices(pod)
+
+	// link the pod with the network policies selecting it
+	_, _ = c.linkPodToK8SObject(K8SNetworkPolicy, pod)
 
-	// link the pod with replication controllers
-	_, _ = c.linkPodToK8SObject(K8SReplicationController, pod)
+	// link the pod with the disruption budgets selecting it
+	_, _ = c.linkPodToK8SObject(K8SPodDisruptionBudget, pod)
+
+	// link the pod with the controller owning it
+	_, _ = c.linkToOwner(pod)
 
 	// link the pod with any existing PVCs
-	_, _ = c.linkPodToPVCs(pod)
+	_, _ = c.linkPodToPVCs(pod, previous)
+
+	// link the pod with the node it is placed on
+	_, _ = c.linkPodToNode(pod, previous)
+
+	// link the pod with the config maps and secrets it uses
+	_, _ = c.linkPodToNamed(pod, previous, K8SConfigMap, ConfigMapNameTag, "configMaps")
+	_, _ = c.linkPodToNamed(pod, previous, K8SSecret, SecretNameTag, "secrets")
+
+	// record the pod containers and the images they run
+	if result, err := c.putContainers(event, pod); check(result, err) {
+		return result, err
+	}
+
+	// link the pod with the service account it runs as, removing the link to a previous one
+	saKey := func(name string) string {
+		return fmt.Sprintf("%s-%s-%s", NS(event), ServiceAccountNameTag, name)
+	}
+	for _, sa := range removedNames(attributeNames(previous, "serviceAccount"), attributeNames(pod, "serviceAccount")) {
+		_, _ = c.deleteResource("link", c.getLink(pod.Key, saKey(sa)).KeyValue())
+	}
+	if sa := pod.Attribute["serviceAccount"].(string); len(sa) > 0 {
+		_, _ = c.linkIfExists(pod.Key, saKey(sa))
+	}
 
 	return result, err
 }
 
+// push the containers of the passed-in pod and their images to the CMDB
+func (c *Client) putContainers(event []byte, pod *Item) (*Result, error) {
+	containers, err := containerItems(event, pod)
+	if err != nil {
+		c.Log.Errorf("Failed to get CONTAINER information: %s.", err)
+		return nil, err
+	}
+	for _, container := range containers {
+		// gets the container as previously recorded to find out if its image has changed
+		previous, err := c.getItem(container.Key)
+		if err != nil {
+			return nil, err
+		}
+		_, result, err := c.putResource(container, "item")
+		if check(result, err) {
+			return result, err
+		}
+		_, result, err = c.putResource(c.getLink(pod.Key, container.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+		image := imageItem(container.Attribute["image"].(string), container.Attribute["imageID"].(string))
+		_, result, err = c.putResource(image, "item")
+		if check(result, err) {
+			return result, err
+		}
+		_, result, err = c.putResource(c.getLink(container.Key, image.Key), "link")
+		if check(result, err) {
+			return result, err
+		}
+		// unlinks the image previously used, e.g. identified by its tag until the digest was resolved
+		if previous != nil {
+			reference, _ := previous.Attribute["image"].(string)
+			imageID, _ := previous.Attribute["imageID"].(string)
+			if previousImage := imageItem(reference, imageID); previousImage.Key != image.Key {
+				result, err = c.deleteResource("link", c.getLink(container.Key, previousImage.Key).KeyValue())
+				if check(result, err) {
+					return result, err
+				}
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// delete a pod and its containers, the images are kept as they might be used by other pods
+func (c *Client) deletePod(event []byte) (*Result, error) {
+	key := itemKey(event, PodNameTag)
+	pod, err := c.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+	if pod != nil {
+		for _, name := range podContainerNames(pod) {
+			result, err := c.removeItem(fmt.Sprintf("%s-%s-%s", key, ContainerNameTag, name), nil)
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return c.removeItem(key, event)
+}
+
+// gets the names of the containers of the passed-in pod
+func podContainerNames(pod *Item) []string {
+	var names []string
+	containers, _ := pod.Attribute["containers"].(string)
+	for _, name := range strings.Split(containers, ",") {
+		names = appendUnique(names, name)
+	}
+	return names
+}
+
 func (c *Client) putService(event []byte) (*Result, error) {
 	// gets the service item information
 	item, err := item(event, K8SService, ServiceNameTag)
@@ -93,12 +322,79 @@ func (c *Client) putService(event []byte) (*Result, error) {
 	// push the item to the CMDB
 	_, result, err := c.putResource(item, "item")
 
-	// check if there are pods that should be linked to this service
-	_, _ = c.linkK8SObjectToPods(item)
+	// check if there are ingresses or routes that should be linked to this service
+	_, _ = c.linkServiceToIngresses(item)
+
+	// check if there are endpoints recording the pods backing this service
+	_, _ = c.linkServiceToEndpoints(item)
 
 	return result, err
 }
 
+func (c *Client) putEndpoints(event []byte) (*Result, error) {
+	// gets the endpoints item information
+	item, err := endpointsItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get ENDPOINTS information: %s.", err)
+		return nil, err
+	}
+	return c.putEndpointsItem(item)
+}
+
+func (c *Client) putEndpointSlice(event []byte) (*Result, error) {
+	// gets the endpoint slice item information
+	item, err := endpointSliceItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get ENDPOINT SLICE information: %s.", err)
+		return nil, err
+	}
+	return c.putEndpointsItem(item)
+}
+
+// push the endpoints of a service to the CMDB and link the service with the pods backing it
+func (c *Client) putEndpointsItem(item *Item) (*Result, error) {
+	// gets the endpoints as previously recorded to find out which pods no longer back the service
+	previous, err := c.getItem(item.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the endpoints with their service
+	_, _ = c.linkIfExists(item.Key, endpointsServiceKey(item))
+
+	// link the service with the pods backing it
+	_, _ = c.linkEndpointPods(item, previous)
+
+	return result, err
+}
+
+// delete the endpoints of a service and the links between the service and the pods backing it
+func (c *Client) deleteEndpoints(event []byte) (*Result, error) {
+	return c.deleteEndpointsItem(itemKey(event, EndpointsNameTag), event)
+}
+
+// delete an endpoint slice and the links between the service and the pods in the slice
+func (c *Client) deleteEndpointSlice(event []byte) (*Result, error) {
+	return c.deleteEndpointsItem(itemKey(event, EndpointSliceNameTag), event)
+}
+
+func (c *Client) deleteEndpointsItem(key string, event []byte) (*Result, error) {
+	previous, err := c.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		_, _ = c.unlinkEndpointPods(previous, nil)
+	}
+	return c.removeItem(key, event)
+}
+
 func (c *Client) putReplicationController(event []byte) (*Result, error) {
 	// gets the service item information
 	item, err := item(event, K8SReplicationController, ReplicationControllerNameTag)
@@ -109,21 +405,411 @@ func (c *Client) putReplicationController(event []byte) (*Result, error) {
 	// push the item to the CMDB
 	_, result, err := c.putResource(item, "item")
 
-	// check if there are pods that should be linked to this replication controller
-	_, _ = c.linkK8SObjectToPods(item)
+	// check if there are pods owned by this replication controller
+	_, _ = c.linkOwnedItems(item, K8SPod)
+
+	// check if there are autoscalers scaling this controller
+	_, _ = c.linkAutoscalers(item)
+
+	return result, err
+}
+
+func (c *Client) putDeployment(event []byte) (*Result, error) {
+	// gets the deployment item information
+	item, err := item(event, K8SDeployment, DeploymentNameTag)
+	if err != nil {
+		c.Log.Errorf("Failed to get DEPLOYMENT information: %s.", err)
+		return nil, err
+	}
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are replica sets owned by this deployment
+	_, _ = c.linkOwnedItems(item, K8SReplicaSet)
+
+	// check if there are autoscalers scaling this controller
+	_, _ = c.linkAutoscalers(item)
+
+	return result, err
+}
+
+func (c *Client) putReplicaSet(event []byte) (*Result, error) {
+	// gets the replica set item information
+	item, err := item(event, K8SReplicaSet, ReplicaSetNameTag)
+	if err != nil {
+		c.Log.Errorf("Failed to get REPLICA SET information: %s.", err)
+		return nil, err
+	}
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the replica set with the deployment owning it
+	_, _ = c.linkToOwner(item)
+
+	// check if there are pods owned by this replica set
+	_, _ = c.linkOwnedItems(item, K8SPod)
+
+	// check if there are autoscalers scaling this controller
+	_, _ = c.linkAutoscalers(item)
+
+	return result, err
+}
+
+func (c *Client) putStatefulSet(event []byte) (*Result, error) {
+	// gets the stateful set item information
+	item, err := statefulSetItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get STATEFUL SET information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods owned by this stateful set
+	_, _ = c.linkOwnedItems(item, K8SPod)
+
+	// check if there are autoscalers scaling this controller
+	_, _ = c.linkAutoscalers(item)
+
+	// check if there are PVCs generated from the volume claim templates
+	_, _ = c.linkStatefulSetToPVCs(item)
+
+	return result, err
+}
+
+func (c *Client) putDaemonSet(event []byte) (*Result, error) {
+	// gets the daemon set item information
+	item, err := item(event, K8SDaemonSet, DaemonSetNameTag)
+	if err != nil {
+		c.Log.Errorf("Failed to get DAEMON SET information: %s.", err)
+		return nil, err
+	}
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods owned by this daemon set
+	_, _ = c.linkOwnedItems(item, K8SPod)
+
+	return result, err
+}
+
+func (c *Client) putCronJob(event []byte) (*Result, error) {
+	// gets the cron job item information
+	item, err := cronJobItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get CRON JOB information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are jobs scheduled by this cron job
+	_, _ = c.linkOwnedItems(item, K8SJob)
+
+	return result, err
+}
+
+func (c *Client) putJob(event []byte) (*Result, error) {
+	// gets the job item information
+	item, err := jobItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get JOB information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the job with the cron job that scheduled it
+	_, _ = c.linkToOwner(item)
+
+	// check if there are pods run by this job
+	_, _ = c.linkOwnedItems(item, K8SPod)
 
 	return result, err
 }
 
 func (c *Client) putPersistentVolumeClaim(event []byte) (*Result, error) {
-	// gets the persistent volume item information
-	item, err := item(event, K8SPersistentVolumeClaim, PersistentVolumeClaimNameTag)
+	// gets the persistent volume claim item information
+	item, err := persistentVolumeClaimItem(event)
 	if err != nil {
 		c.Log.Errorf("Failed to get PERSISTENT VOLUME CLAIM information: %s.", err)
 		return nil, err
 	}
+
+	// gets the claim as previously recorded to find out if it is bound to another volume
+	previous, err := c.getItem(item.Key)
+	if err != nil {
+		return nil, err
+	}
+
 	// push the volume to the CMDB
 	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if the claim was generated by a stateful set
+	_, _ = c.linkPVCToStatefulSets(item)
+
+	// link the claim with the volume it is bound to, removing the link to a previous one
+	volumeKey := func(name string) string {
+		return clusterItemKey(item.Attribute["cluster"].(string), PersistentVolumeNameTag, name)
+	}
+	for _, volume := range removedNames(attributeNames(previous, "volumeName"), attributeNames(item, "volumeName")) {
+		_, _ = c.deleteResource("link", c.getLink(item.Key, volumeKey(volume)).KeyValue())
+	}
+	if volume := item.Attribute["volumeName"].(string); len(volume) > 0 {
+		_, _ = c.linkIfExists(item.Key, volumeKey(volume))
+	}
+
+	return result, err
+}
+
+func (c *Client) putConfigMap(event []byte) (*Result, error) {
+	// gets the config map item information
+	item, err := configMapItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get CONFIG MAP information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods using this config map
+	_, _ = c.linkNamedToPods(item, "configMaps")
+
+	return result, err
+}
+
+func (c *Client) putSecret(event []byte) (*Result, error) {
+	// gets the secret item information
+	item, err := secretItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get SECRET information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods using this secret
+	_, _ = c.linkNamedToPods(item, "secrets")
+
+	return result, err
+}
+
+func (c *Client) putServiceAccount(event []byte) (*Result, error) {
+	// gets the service account item information
+	sa, err := serviceAccountItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get SERVICE ACCOUNT information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(sa, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are pods running as this service account
+	_, _ = c.linkServiceAccountToPods(sa)
+
+	// check if there are bindings granting permissions to this service account
+	_, _ = c.linkServiceAccountToBindings(sa)
+
+	return result, err
+}
+
+func (c *Client) putRole(event []byte) (*Result, error) {
+	// gets the role item information
+	role, err := roleItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get ROLE information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(role, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are bindings referencing this role
+	_, _ = c.linkRoleToBindings(role, "Role")
+
+	return result, err
+}
+
+func (c *Client) putClusterRole(event []byte) (*Result, error) {
+	// gets the cluster role item information
+	role, err := clusterRoleItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get CLUSTER ROLE information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB under the cluster
+	result, err := c.putInCluster(event, role)
+	if check(result, err) {
+		return result, err
+	}
+
+	// check if there are bindings referencing this cluster role
+	_, _ = c.linkRoleToBindings(role, "ClusterRole")
+
+	return result, err
+}
+
+func (c *Client) putRoleBinding(event []byte) (*Result, error) {
+	// gets the role binding item information
+	binding, err := roleBindingItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get ROLE BINDING information: %s.", err)
+		return nil, err
+	}
+
+	// gets the binding as previously recorded to find out if its role or subjects have changed
+	previous, err := c.getItem(binding.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(binding, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the binding with its role and service accounts
+	_, _ = c.linkBinding(binding, previous)
+
+	return result, err
+}
+
+func (c *Client) putClusterRoleBinding(event []byte) (*Result, error) {
+	// gets the cluster role binding item information
+	binding, err := clusterRoleBindingItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get CLUSTER ROLE BINDING information: %s.", err)
+		return nil, err
+	}
+
+	// gets the binding as previously recorded to find out if its role or subjects have changed
+	previous, err := c.getItem(binding.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// push the item to the CMDB under the cluster
+	result, err := c.putInCluster(event, binding)
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the binding with its cluster role and service accounts
+	_, _ = c.linkBinding(binding, previous)
+
+	return result, err
+}
+
+func (c *Client) putNetworkPolicy(event []byte) (*Result, error) {
+	// gets the network policy item information
+	policy, err := networkPolicyItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get NETWORK POLICY information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(policy, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the policy with the pods it selects
+	_, _ = c.linkK8SObjectToPods(policy)
+
+	return result, err
+}
+
+func (c *Client) putHorizontalPodAutoscaler(event []byte) (*Result, error) {
+	// gets the horizontal pod autoscaler item information
+	hpa, err := autoscalerItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get HORIZONTAL POD AUTOSCALER information: %s.", err)
+		return nil, err
+	}
+
+	// gets the autoscaler as previously recorded to find out if it scales another controller
+	previous, err := c.getItem(hpa.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(hpa, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the autoscaler with the controller it scales, removing the link to a previous one
+	if previous != nil {
+		if key := scaleTargetKey(previous); len(key) > 0 && key != scaleTargetKey(hpa) {
+			_, _ = c.deleteResource("link", c.getLink(hpa.Key, key).KeyValue())
+		}
+	}
+	if key := scaleTargetKey(hpa); len(key) > 0 {
+		_, _ = c.linkIfExists(hpa.Key, key)
+	}
+
+	return result, err
+}
+
+func (c *Client) putPodDisruptionBudget(event []byte) (*Result, error) {
+	// gets the pod disruption budget item information
+	pdb, err := podDisruptionBudgetItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get POD DISRUPTION BUDGET information: %s.", err)
+		return nil, err
+	}
+
+	// push the item to the CMDB
+	_, result, err := c.putResource(pdb, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// link the budget with the pods it selects
+	_, _ = c.linkK8SObjectToPods(pdb)
 
 	return result, err
 }
@@ -144,12 +830,69 @@ func (c *Client) putResourceQuota(event []byte) (*Result, error) {
 	return result, err
 }
 
+func (c *Client) putLimitRange(event []byte) (*Result, error) {
+	// gets the limit range item information
+	item, err := limitRangeItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get LIMIT RANGE information: %s.", err)
+		return nil, err
+	}
+	// push the limit range to the CMDB
+	limitRangeKey, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+
+	// ensure link between namespace and limit range exist
+	_, result, err = c.putResource(c.getLink(NS(event), limitRangeKey), "link")
+
+	return result, err
+}
+
 func (c *Client) putIngress(event []byte) (*Result, error) {
-	panic("not implemented")
+	// gets the ingress item information
+	item, err := ingressItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get INGRESS information: %s.", err)
+		return nil, err
+	}
+	return c.putIngressItem(item)
+}
+
+func (c *Client) putRoute(event []byte) (*Result, error) {
+	// gets the route item information
+	item, err := routeItem(event)
+	if err != nil {
+		c.Log.Errorf("Failed to get ROUTE information: %s.", err)
+		return nil, err
+	}
+	return c.putIngressItem(item)
 }
 
-// link the passed in pod with any K8S objects in the namespace
-// by matching the objects selectors with the pod labels
+// push an ingress or route item to the CMDB and link it to its backend services
+func (c *Client) putIngressItem(item *Item) (*Result, error) {
+	// gets the ingress as previously recorded to find out if it no longer routes to some services
+	previous, err := c.getItem(item.Key)
+	if err != nil {
+		return nil, err
+	}
+	_, result, err := c.putResource(item, "item")
+	if check(result, err) {
+		return result, err
+	}
+	// link the ingress with the services it routes to, removing the links to the previous ones
+	for _, service := range removedNames(attributeNames(previous, "services"), attributeNames(item, "services")) {
+		serviceKey := fmt.Sprintf("%s-%s-%s", nsKey(item.Attribute["cluster"].(string), item.Attribute["namespace"].(string)), ServiceNameTag, service)
+		_, _ = c.deleteResource("link", c.getLink(serviceKey, item.Key).KeyValue())
+	}
+	_, _ = c.linkIngressToServices(item)
+
+	return result, err
+}
+
+// link the passed-in pod with any K8S objects of the specified type in the namespace
+// whose selectors match the pod labels, removing the links in the CMDB
+// to the objects which no longer select the pod
 func (c *Client) linkPodToK8SObject(objType K8SOBJ, pod *Item) (*Result, error) {
 	// now link the pod with any matching services
 	// query services in the namespace first: /item?type=K8SService&attrs=namespace,value
@@ -162,27 +905,25 @@ func (c *Client) linkPodToK8SObject(objType K8SOBJ, pod *Item) (*Result, error)
 		return nil, err
 	}
 
+	// gets the links of the pod currently in the CMDB
+	links, err := c.getLinks("startItemKey", pod.Key)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, k8sObj := range k8sObjs {
 		// for each k8s object check if the selectors match the pod labels
-		if selector, ok := k8sObj.Meta["selector"]; ok {
-			selectors := selector.(map[string]interface{})
-			for selectorKey, selectorValue := range selectors {
-				// if the pod label matches the service descriptor
-				if pod.Attribute[selectorKey] == selectorValue {
-					// link the k8s object with the pod
-					_, result, err := c.putResource(c.getLink(pod.Key, k8sObj.Key), "link")
-					if err != nil || result.Error {
-						return result, err
-					}
-				}
-			}
+		result, err := c.syncSelectorLink(links, &k8sObj, pod)
+		if check(result, err) {
+			return result, err
 		}
 	}
 	return &Result{}, nil
 }
 
 // link the passed-in K8S object with any existing pods in the namespace
-// by matching the pods labels with the object selectors
+// by matching the pods labels with the object selectors, removing the links
+// in the CMDB to the pods no longer selected
 func (c *Client) linkK8SObjectToPods(k8sObj *Item) (*Result, error) {
 	pods, err := c.getObjectsInNamespace(
 		k8sObj.Attribute["cluster"].(string),
@@ -193,26 +934,92 @@ func (c *Client) linkK8SObjectToPods(k8sObj *Item) (*Result, error) {
 		return nil, err
 	}
 
+	// gets the links to the object currently in the CMDB
+	links, err := c.getLinks("endItemKey", k8sObj.Key)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, pod := range pods {
-		if selector, ok := k8sObj.Meta["selector"]; ok {
-			selectors := selector.(map[string]interface{})
-			for selectorKey, selectorValue := range selectors {
-				// if the pod label matches the object service descriptor
-				if pod.Attribute[selectorKey] == selectorValue {
-					// link the object with the pod
-					_, result, err := c.putResource(c.getLink(pod.Key, k8sObj.Key), "link")
-					if err != nil || result.Error {
-						return result, err
-					}
-				}
-			}
+		result, err := c.syncSelectorLink(links, k8sObj, &pod)
+		if check(result, err) {
+			return result, err
+		}
+	}
+	return &Result{}, nil
+}
+
+// links the pod with the K8S object if its selectors match the pod labels and the link is not
+// in the passed-in links, or deletes the link if it is and the selectors no longer match
+func (c *Client) syncSelectorLink(links map[string]Link, k8sObj *Item, pod *Item) (*Result, error) {
+	link := c.getLink(pod.Key, k8sObj.Key)
+	_, linked := links[link.KeyValue()]
+	if selects(k8sObj, pod) {
+		if linked {
+			return &Result{}, nil
 		}
+		// link the k8s object with the pod
+		_, result, err := c.putResource(link, "link")
+		return result, err
+	}
+	if linked {
+		return c.deleteResource("link", link.KeyValue())
 	}
 	return &Result{}, nil
 }
 
+// checks if the selectors of the passed-in K8S object match the pod labels
+func selects(k8sObj *Item, pod *Item) bool {
+	s, ok := podSelector(k8sObj)
+	if !ok {
+		return false
+	}
+	return s.Matches(itemLabels(pod))
+}
+
+// the meta entry holding the label selector (matchLabels and matchExpressions)
+// of the K8S objects selecting pods with one
+var labelSelectors = map[string]string{
+	K8SNetworkPolicy:       "podSelector",
+	K8SPodDisruptionBudget: "selector",
+}
+
+// gets the selector used by a K8S object to select pods
+// services are not linked by selector as their links to pods are recorded from their endpoints
+func podSelector(k8sObj *Item) (*selector.Selector, bool) {
+	entry, ok := labelSelectors[k8sObj.Type]
+	if !ok {
+		return nil, false
+	}
+	// a missing label selector does not select any pods, whereas an empty one selects all the pods in the namespace
+	labelSelector, ok := k8sObj.Meta[entry].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	s, err := selector.Parse(labelSelector)
+	return s, err == nil
+}
+
+// gets the labels of a pod item, which are recorded in the meta apart from the other attributes
+func itemLabels(item *Item) selector.Set {
+	labels := make(selector.Set)
+	values, _ := item.Meta["labels"].(map[string]interface{})
+	for key, value := range values {
+		if v, ok := value.(string); ok {
+			labels[key] = v
+		}
+	}
+	return labels
+}
+
 // link the passed-in pod to any persistent volume via pod's PVCs
-func (c *Client) linkPodToPVCs(pod *Item) (*Result, error) {
+func (c *Client) linkPodToPVCs(pod *Item, previous *Item) (*Result, error) {
+	claims := podClaimNames(pod)
+	for _, claim := range removedNames(podClaimNames(previous), claims) {
+		claimKey := fmt.Sprintf("%s-%s-%s", nsKey(pod.Attribute["cluster"].(string), pod.Attribute["namespace"].(string)), PersistentVolumeClaimNameTag, claim)
+		_, _ = c.deleteResource("link", c.getLink(pod.Key, claimKey).KeyValue())
+	}
+
 	pvcs, err := c.getObjectsInNamespace(
 		pod.Attribute["cluster"].(string),
 		pod.Attribute["namespace"].(string),
@@ -222,22 +1029,85 @@ func (c *Client) linkPodToPVCs(pod *Item) (*Result, error) {
 		return nil, err
 	}
 
-	if volume, ok := pod.Meta["volumes"]; ok {
-		volumes := volume.([]interface{})
-		for _, volumeMap := range volumes {
-			for k, v := range volumeMap.(map[string]interface{}) {
-				if k == "persistentVolumeClaim" {
-					pvc := v.(map[string]interface{})
-					claim := pvc["claimName"]
-					// check if any of the PVCs can be linked to the pod
-					for _, pvc := range pvcs {
-						if pvc.Name == claim {
-							_, _, _ = c.putResource(c.getLink(pod.Key, pvc.Key), "link")
-						}
-					}
-				}
+	// check if any of the PVCs can be linked to the pod
+	for _, pvc := range pvcs {
+		if contains(claims, pvc.Name) {
+			_, _, _ = c.putResource(c.getLink(pod.Key, pvc.Key), "link")
+		}
+	}
+	return &Result{}, nil
+}
+
+// gets the names of the claims mounted by the passed-in pod, if any
+func podClaimNames(pod *Item) []string {
+	var claims []string
+	if pod == nil {
+		return claims
+	}
+	volumes, _ := pod.Meta["volumes"].([]interface{})
+	for _, volume := range volumes {
+		volumeMap, _ := volume.(map[string]interface{})
+		pvc, _ := volumeMap["persistentVolumeClaim"].(map[string]interface{})
+		claim, _ := pvc["claimName"].(string)
+		claims = appendUnique(claims, claim)
+	}
+	return claims
+}
+
+// link the passed-in ingress with the services in the namespace it routes to
+func (c *Client) linkIngressToServices(ingress *Item) (*Result, error) {
+	services, err := c.getObjectsInNamespace(
+		ingress.Attribute["cluster"].(string),
+		ingress.Attribute["namespace"].(string),
+		K8SService)
+
+	if err != nil {
+		return nil, err
+	}
+
+	backends := strings.Split(ingress.Attribute["services"].(string), ",")
+	for _, service := range services {
+		if contains(backends, service.Name) {
+			_, result, err := c.putResource(c.getLink(service.Key, ingress.Key), "link")
+			if check(result, err) {
+				return result, err
 			}
 		}
 	}
 	return &Result{}, nil
 }
+
+// link the passed-in service with any existing ingresses or routes in the namespace routing to it
+func (c *Client) linkServiceToIngresses(service *Item) (*Result, error) {
+	ingresses, err := c.getObjectsInNamespace(
+		service.Attribute["cluster"].(string),
+		service.Attribute["namespace"].(string),
+		K8SIngress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ingress := range ingresses {
+		backends, _ := ingress.Attribute["services"].(string)
+		if contains(strings.Split(backends, ","), service.Name) {
+			_, result, err := c.putResource(c.getLink(service.Key, ingress.Key), "link")
+			if check(result, err) {
+				return result, err
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// appends the name of the service of an ingress backend
+// supporting both the extensions/v1beta1 and networking.k8s.io/v1 formats
+func appendBackend(services []string, backend gjson.Result) []string {
+	if name := backend.Get("serviceName").String(); len(name) > 0 {
+		return appendUnique(services, name)
+	}
+	if name := backend.Get("service.name").String(); len(name) > 0 {
+		return appendUnique(services, name)
+	}
+	return services
+}
@@ -0,0 +1,515 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// a pod labelled tier=web with an annotation and attributes sharing names with selected labels
+var selectedPodEvent = []byte(`{"Change":{"kind":"pod","type":"create","name":"web-1","namespace":"ns1","host":"test"},` +
+	`"Object":{"metadata":{"labels":{"tier":"web"},"annotations":{"tier":"db","owner":"team"}},"spec":{},"status":{"phase":"Running"}}}`)
+
+func TestSelectorsMatchPodLabelsOnly(t *testing.T) {
+	pod, err := item(selectedPodEvent, K8SPod, PodNameTag)
+	if err != nil {
+		t.Fatalf("failed to get the pod item: %s", err)
+	}
+	pod.Meta["labels"] = objectLabels(selectedPodEvent)
+	expression := func(key string, operator string, values ...interface{}) MAP {
+		return MAP{"podSelector": map[string]interface{}{
+			"matchExpressions": []interface{}{map[string]interface{}{"key": key, "operator": operator, "values": values}},
+		}}
+	}
+	matchLabels := func(key string, value string) MAP {
+		return MAP{"selector": map[string]interface{}{"matchLabels": map[string]interface{}{key: value}}}
+	}
+	cases := []struct {
+		name     string
+		objType  string
+		meta     MAP
+		expected bool
+	}{
+		{"label", K8SPodDisruptionBudget, matchLabels("tier", "web"), true},
+		{"annotation with the label name", K8SPodDisruptionBudget, matchLabels("tier", "db"), false},
+		{"attribute", K8SPodDisruptionBudget, matchLabels("cluster", "test"), false},
+		{"annotation", K8SPodDisruptionBudget, matchLabels("owner", "team"), false},
+		{"service", K8SService, MAP{"selector": map[string]interface{}{"tier": "web"}}, false},
+		{"label in", K8SNetworkPolicy, expression("tier", "In", "web"), true},
+		{"label not in annotation value", K8SNetworkPolicy, expression("tier", "NotIn", "db"), true},
+		{"attribute exists", K8SNetworkPolicy, expression("namespace", "Exists"), false},
+		{"attribute does not exist", K8SNetworkPolicy, expression("cluster", "DoesNotExist"), true},
+		{"status does not exist", K8SNetworkPolicy, expression("status.phase", "DoesNotExist"), true},
+	}
+	for _, c := range cases {
+		k8sObj := &Item{Type: c.objType, Meta: c.meta}
+		if matched := selects(k8sObj, pod); matched != c.expected {
+			t.Errorf("%s: expected the selector match to be %t, got %t", c.name, c.expected, matched)
+		}
+	}
+}
+
+// a change processed by a put test with the links expected to exist and not to exist after it,
+// and the attributes expected of the items (nil if the attribute is not recorded)
+type putStep struct {
+	event      []byte
+	linked     []string
+	unlinked   []string
+	attributes map[string]MAP
+}
+
+// processes the steps of a put test checking the in-memory CMDB after each one
+func runPutSteps(t *testing.T, onix *memOnix, ox *Client, steps []putStep) {
+	for i, step := range steps {
+		result, err := ox.process(step.event)
+		if check(result, err) {
+			t.Fatalf("step %d: failed to process the event: %v %v", i+1, result, err)
+		}
+		onix.Lock()
+		for _, key := range step.linked {
+			if _, ok := onix.links[key]; !ok {
+				t.Errorf("step %d: expected link %s", i+1, key)
+			}
+		}
+		for _, key := range step.unlinked {
+			if _, ok := onix.links[key]; ok {
+				t.Errorf("step %d: expected no link %s", i+1, key)
+			}
+		}
+		for key, attributes := range step.attributes {
+			for name, value := range attributes {
+				if actual := onix.items[key].Attribute[name]; actual != value {
+					t.Errorf("step %d: expected %s attribute %s to be '%v', got '%v'", i+1, key, name, value, actual)
+				}
+			}
+		}
+		onix.Unlock()
+	}
+}
+
+// the key of an item in the test namespace
+func ns1Key(tag string, name string) string {
+	return nsKey("test", "ns1") + "-" + tag + "-" + name
+}
+
+// the key of a link between the passed-in items
+func linkKey(start string, end string) string {
+	return start + "->" + end
+}
+
+func TestPutIngressesAndRoutesLinkTheirBackendServices(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	web, canary := ns1Key(ServiceNameTag, "web"), ns1Key(ServiceNameTag, "canary")
+	ingress, legacy, route := ns1Key(IngressNameTag, "web"), ns1Key(IngressNameTag, "legacy"), ns1Key(RouteNameTag, "web")
+
+	runPutSteps(t, onix, ox, []putStep{
+		// the ingress is recorded before its backend service
+		{event: objectEvent("ingress", "web",
+			`"spec":{"rules":[{"host":"web.com","http":{"paths":[{"path":"/","backend":{"service":{"name":"web"}}}]}}],"tls":[{"hosts":["web.com"]}]}`),
+			unlinked:   []string{linkKey(web, ingress)},
+			attributes: map[string]MAP{ingress: {"hosts": "web.com", "paths": "web.com/", "tls": "true", "services": "web"}}},
+		{event: objectEvent("service", "web", `"spec":{}`),
+			linked: []string{linkKey(web, ingress)}},
+		// the extensions/v1beta1 backends
+		{event: objectEvent("ingress", "legacy", `"spec":{"backend":{"serviceName":"web"}}`),
+			linked:     []string{linkKey(web, legacy)},
+			attributes: map[string]MAP{legacy: {"tls": "false", "services": "web"}}},
+		// the route to a service recorded and an alternate backend that is not
+		{event: objectEvent("route", "web",
+			`"spec":{"host":"web.apps.com","to":{"kind":"Service","name":"web"},"alternateBackends":[{"kind":"Service","name":"canary"}],"tls":{"termination":"edge"}}`),
+			linked:     []string{linkKey(web, route)},
+			unlinked:   []string{linkKey(canary, route)},
+			attributes: map[string]MAP{route: {"hosts": "web.apps.com", "tlsTermination": "edge", "services": "web,canary"}}},
+		{event: objectEvent("service", "canary", `"spec":{}`),
+			linked: []string{linkKey(canary, route)}},
+	})
+}
+
+// an event for an object of the passed-in kind with the passed-in metadata and object fields
+func metadataEvent(kind string, name string, metadata string, object string) []byte {
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"%s","type":"create","name":"%s","namespace":"ns1","host":"test"},"Object":{"metadata":{"name":"%s",%s},%s}}`,
+		kind, name, name, metadata, object))
+}
+
+func TestPutStatefulAndDaemonSetsLinkTheirClaimsAndPods(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	sts, ds := ns1Key(StatefulSetNameTag, "db"), ns1Key(DaemonSetNameTag, "agent")
+	data0, data1, other := ns1Key(PersistentVolumeClaimNameTag, "data-db-0"), ns1Key(PersistentVolumeClaimNameTag, "data-db-1"), ns1Key(PersistentVolumeClaimNameTag, "data-db-x")
+	db0, agent := ns1Key(PodNameTag, "db-0"), ns1Key(PodNameTag, "agent-a")
+
+	runPutSteps(t, onix, ox, []putStep{
+		// a claim generated from the template before the stateful set is recorded
+		{event: objectEvent("persistent_volume_claim", "data-db-1", `"spec":{}`)},
+		{event: objectEvent("stateful_set", "db", `"spec":{"replicas":2,"volumeClaimTemplates":[{"metadata":{"name":"data"}}]}`),
+			linked:     []string{linkKey(sts, data1)},
+			attributes: map[string]MAP{sts: {"volumeClaimTemplates": "data"}}},
+		{event: objectEvent("persistent_volume_claim", "data-db-0", `"spec":{}`),
+			linked: []string{linkKey(sts, data0)}},
+		// a claim named after the template without a pod ordinal
+		{event: objectEvent("persistent_volume_claim", "data-db-x", `"spec":{}`),
+			unlinked: []string{linkKey(sts, other)}},
+		// the pod of the stateful set mounting its claim
+		{event: metadataEvent("pod", "db-0", `"ownerReferences":[{"kind":"StatefulSet","name":"db"}]`,
+			`"spec":{"volumes":[{"name":"data","persistentVolumeClaim":{"claimName":"data-db-0"}}]}`),
+			linked:   []string{linkKey(db0, sts), linkKey(db0, data0)},
+			unlinked: []string{linkKey(db0, data1)}},
+		// the pod of a daemon set recorded before the daemon set
+		{event: metadataEvent("pod", "agent-a", `"ownerReferences":[{"kind":"DaemonSet","name":"agent"}]`, `"spec":{}`),
+			unlinked: []string{linkKey(agent, ds)}},
+		{event: objectEvent("daemon_set", "agent", `"spec":{}`),
+			linked: []string{linkKey(agent, ds)}},
+	})
+}
+
+func TestPutCronJobsAndJobsRecordTheirRunHistory(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	cj, job1, job2 := ns1Key(CronJobNameTag, "backup"), ns1Key(JobNameTag, "backup-1"), ns1Key(JobNameTag, "backup-2")
+	pod := ns1Key(PodNameTag, "backup-1-x")
+	owner := func(kind string, name string) string {
+		return fmt.Sprintf(`"ownerReferences":[{"kind":"%s","name":"%s"}]`, kind, name)
+	}
+
+	runPutSteps(t, onix, ox, []putStep{
+		{event: objectEvent("cron_job", "backup", `"spec":{"schedule":"0 1 * * *"},"status":{"lastScheduleTime":"2020-01-01T01:00:00Z"}`),
+			attributes: map[string]MAP{cj: {"schedule": "0 1 * * *", "suspend": "false",
+				"status.lastScheduleTime": "2020-01-01T01:00:00Z", "status.lastSuccessfulTime": ""}}},
+		{event: metadataEvent("job", "backup-1", owner("CronJob", "backup"),
+			`"spec":{"completions":1,"parallelism":1},"status":{"succeeded":1,"startTime":"2020-01-01T01:00:00Z","completionTime":"2020-01-01T01:05:00Z"}`),
+			linked: []string{linkKey(job1, cj)},
+			attributes: map[string]MAP{job1: {"completions": "1", "parallelism": "1", "status.active": "0", "status.succeeded": "1",
+				"status.failed": "0", "status.startTime": "2020-01-01T01:00:00Z", "status.completionTime": "2020-01-01T01:05:00Z"}}},
+		{event: metadataEvent("pod", "backup-1-x", owner("Job", "backup-1"), `"spec":{}`),
+			linked: []string{linkKey(pod, job1)}},
+		{event: metadataEvent("job", "backup-2", owner("CronJob", "backup"), `"spec":{"completions":1},"status":{"failed":1}`),
+			linked:     []string{linkKey(job1, cj), linkKey(job2, cj)},
+			attributes: map[string]MAP{job2: {"status.succeeded": "0", "status.failed": "1", "status.completionTime": ""}}},
+		{event: objectEvent("cron_job", "backup",
+			`"spec":{"schedule":"0 1 * * *","suspend":true},"status":{"lastScheduleTime":"2020-01-02T01:00:00Z","lastSuccessfulTime":"2020-01-01T01:05:00Z"}`),
+			linked: []string{linkKey(job1, cj), linkKey(job2, cj)},
+			attributes: map[string]MAP{cj: {"suspend": "true",
+				"status.lastScheduleTime": "2020-01-02T01:00:00Z", "status.lastSuccessfulTime": "2020-01-01T01:05:00Z"}}},
+	})
+}
+
+// an event for a cluster scoped object of the passed-in kind with the passed-in metadata and object fields
+func clusterEvent(kind string, name string, metadata string, object string) []byte {
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"%s","type":"create","name":"%s","namespace":"","host":"test"},"Object":{"metadata":{"name":"%s"%s},%s}}`,
+		kind, name, name, metadata, object))
+}
+
+func TestPutPodsAndNodesLinkThePodPlacement(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	n1, n2 := clusterItemKey("test", NodeNameTag, "n1"), clusterItemKey("test", NodeNameTag, "n2")
+	pod := ns1Key(PodNameTag, "web-1")
+
+	runPutSteps(t, onix, ox, []putStep{
+		// the pod is placed on a node not recorded yet
+		{event: objectEvent("pod", "web-1", `"spec":{"nodeName":"n1"}`),
+			unlinked:   []string{linkKey(pod, n1)},
+			attributes: map[string]MAP{pod: {"nodeName": "n1"}}},
+		{event: clusterEvent("node", "n1", `,"labels":{"topology.kubernetes.io/zone":"eu-1a","failure-domain.beta.kubernetes.io/region":"eu"}`,
+			`"spec":{},"status":{"capacity":{"cpu":"4","memory":"16Gi"},"nodeInfo":{"kubeletVersion":"v1.18.0"}}`),
+			linked: []string{linkKey(pod, n1), linkKey(clusterKey("test"), n1)},
+			attributes: map[string]MAP{n1: {"zone": "eu-1a", "region": "eu", "status.capacity.cpu": "4",
+				"status.capacity.memory": "16Gi", "status.nodeInfo.kubeletVersion": "v1.18.0"}}},
+		{event: clusterEvent("node", "n2", "", `"spec":{}`),
+			unlinked: []string{linkKey(pod, n2)}},
+		// the pod is rescheduled on the other node
+		{event: objectEvent("pod", "web-1", `"spec":{"nodeName":"n2"}`),
+			linked:   []string{linkKey(pod, n2)},
+			unlinked: []string{linkKey(pod, n1)}},
+	})
+}
+
+func TestPutClaimsVolumesAndStorageClassesLinkTheStorageChain(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	fast, slow := clusterItemKey("test", StorageClassNameTag, "fast"), clusterItemKey("test", StorageClassNameTag, "slow")
+	pv1, pv2 := clusterItemKey("test", PersistentVolumeNameTag, "pv1"), clusterItemKey("test", PersistentVolumeNameTag, "pv2")
+	data, logs := ns1Key(PersistentVolumeClaimNameTag, "data"), ns1Key(PersistentVolumeClaimNameTag, "logs")
+
+	runPutSteps(t, onix, ox, []putStep{
+		{event: clusterEvent("storage_class", "fast", "", `"provisioner":"kubernetes.io/aws-ebs","reclaimPolicy":"Delete","allowVolumeExpansion":true`),
+			linked:     []string{linkKey(clusterKey("test"), fast)},
+			attributes: map[string]MAP{fast: {"provisioner": "kubernetes.io/aws-ebs", "reclaimPolicy": "Delete", "allowVolumeExpansion": "true"}}},
+		// the claim is bound to a volume not recorded yet
+		{event: objectEvent("persistent_volume_claim", "data", `"spec":{"volumeName":"pv1"},"status":{"phase":"Bound"}`),
+			unlinked:   []string{linkKey(data, pv1)},
+			attributes: map[string]MAP{data: {"volumeName": "pv1", "status.phase": "Bound"}}},
+		{event: clusterEvent("persistent_volume", "pv1", "",
+			`"spec":{"capacity":{"storage":"10Gi"},"accessModes":["ReadWriteOnce"],"storageClassName":"fast","claimRef":{"namespace":"ns1","name":"data"}}`),
+			linked:     []string{linkKey(data, pv1), linkKey(pv1, fast)},
+			attributes: map[string]MAP{pv1: {"capacity": "10Gi", "accessModes": "ReadWriteOnce", "storageClassName": "fast"}}},
+		// the volume is recorded before its storage class and its claim
+		{event: clusterEvent("persistent_volume", "pv2", "", `"spec":{"storageClassName":"slow","claimRef":{"namespace":"ns1","name":"logs"}}`),
+			unlinked: []string{linkKey(pv2, slow), linkKey(logs, pv2)}},
+		{event: clusterEvent("storage_class", "slow", "", `"provisioner":"kubernetes.io/aws-ebs"`),
+			linked: []string{linkKey(pv2, slow)}},
+		{event: objectEvent("persistent_volume_claim", "logs", `"spec":{"volumeName":"pv2"}`),
+			linked: []string{linkKey(logs, pv2)}},
+	})
+}
+
+func TestPutConfigMapsAndSecretsLinkThePodsUsingThem(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	settings, env := ns1Key(ConfigMapNameTag, "settings"), ns1Key(ConfigMapNameTag, "env")
+	creds, tls, pull := ns1Key(SecretNameTag, "creds"), ns1Key(SecretNameTag, "tls"), ns1Key(SecretNameTag, "pull")
+	pod := ns1Key(PodNameTag, "web-1")
+
+	runPutSteps(t, onix, ox, []putStep{
+		{event: objectEvent("config_map", "settings", `"data":{"b":"2","a":"1"}`),
+			attributes: map[string]MAP{settings: {"keys": "a,b"}}},
+		{event: objectEvent("secret", "creds", `"type":"Opaque","data":{"password":"c2VjcmV0"}`),
+			attributes: map[string]MAP{creds: {"type": "Opaque", "keys": "password"}}},
+		// the pod mounts and reads from environment variables config maps and secrets, some not recorded yet
+		{event: objectEvent("pod", "web-1", `"spec":{"volumes":[{"name":"a","configMap":{"name":"settings"}},{"name":"b","secret":{"secretName":"tls"}}],`+
+			`"containers":[{"name":"web","envFrom":[{"configMapRef":{"name":"env"}}],"env":[{"name":"P","valueFrom":{"secretKeyRef":{"name":"creds","key":"password"}}}]}],`+
+			`"imagePullSecrets":[{"name":"pull"}]}`),
+			linked:     []string{linkKey(pod, settings), linkKey(pod, creds)},
+			unlinked:   []string{linkKey(pod, env), linkKey(pod, tls), linkKey(pod, pull)},
+			attributes: map[string]MAP{pod: {"configMaps": "settings,env", "secrets": "tls,creds,pull"}}},
+		{event: objectEvent("config_map", "env", `"data":{"c":"3"}`),
+			linked: []string{linkKey(pod, env)}},
+		{event: objectEvent("secret", "tls", `"type":"kubernetes.io/tls","data":{"tls.crt":"","tls.key":""}`),
+			linked: []string{linkKey(pod, tls)}},
+		{event: objectEvent("secret", "pull", `"type":"kubernetes.io/dockerconfigjson","data":{".dockerconfigjson":""}`),
+			linked: []string{linkKey(pod, pull)}},
+	})
+}
+
+func TestPutServiceAccountsAndRBACLinkTheBindings(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	pod, sa := ns1Key(PodNameTag, "web-1"), ns1Key(ServiceAccountNameTag, "app")
+	role, reader, view := ns1Key(RoleNameTag, "reader"), ns1Key(RoleBindingNameTag, "app-reader"), ns1Key(RoleBindingNameTag, "app-view")
+	admin, adminBinding := clusterItemKey("test", ClusterRoleNameTag, "admin"), clusterItemKey("test", ClusterRoleBindingNameTag, "app-admin")
+	subjects := `"subjects":[{"kind":"ServiceAccount","name":"app","namespace":"ns1"},{"kind":"User","name":"jane"}]`
+
+	runPutSteps(t, onix, ox, []putStep{
+		// the pod runs as a service account not recorded yet
+		{event: objectEvent("pod", "web-1", `"spec":{"serviceAccountName":"app"}`),
+			unlinked:   []string{linkKey(pod, sa)},
+			attributes: map[string]MAP{pod: {"serviceAccount": "app"}}},
+		{event: objectEvent("service_account", "app", `"secrets":[{"name":"app-token"}],"automountServiceAccountToken":false`),
+			linked:     []string{linkKey(pod, sa)},
+			attributes: map[string]MAP{sa: {"secrets": "app-token", "automountServiceAccountToken": "false"}}},
+		{event: objectEvent("role", "reader", `"rules":[{"apiGroups":[""],"resources":["pods"],"verbs":["get","list"]}]`)},
+		{event: objectEvent("role_binding", "app-reader", `"roleRef":{"kind":"Role","name":"reader"},`+subjects),
+			linked:     []string{linkKey(sa, reader), linkKey(reader, role)},
+			attributes: map[string]MAP{reader: {"roleKind": "Role", "roleName": "reader", "serviceAccounts": "ns1/app"}}},
+		// the bindings of a cluster role recorded before it
+		{event: clusterEvent("cluster_role_binding", "app-admin", "", `"roleRef":{"kind":"ClusterRole","name":"admin"},`+subjects),
+			linked:   []string{linkKey(sa, adminBinding)},
+			unlinked: []string{linkKey(adminBinding, admin)}},
+		{event: objectEvent("role_binding", "app-view", `"roleRef":{"kind":"ClusterRole","name":"admin"},`+subjects),
+			linked:   []string{linkKey(sa, view)},
+			unlinked: []string{linkKey(view, admin)}},
+		{event: clusterEvent("cluster_role", "admin", "", `"rules":[{"apiGroups":["*"],"resources":["*"],"verbs":["*"]}]`),
+			linked: []string{linkKey(adminBinding, admin), linkKey(view, admin), linkKey(clusterKey("test"), admin)}},
+	})
+}
+
+func TestPutNetworkPoliciesLinkTheSelectedPods(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	web, db := ns1Key(PodNameTag, "web-1"), ns1Key(PodNameTag, "db-1")
+	policy, all := ns1Key(NetworkPolicyNameTag, "web"), ns1Key(NetworkPolicyNameTag, "all")
+
+	runPutSteps(t, onix, ox, []putStep{
+		{event: metadataEvent("pod", "web-1", `"labels":{"tier":"web"}`, `"spec":{}`)},
+		{event: metadataEvent("pod", "db-1", `"labels":{"tier":"db"}`, `"spec":{}`)},
+		{event: objectEvent("network_policy", "web",
+			`"spec":{"podSelector":{"matchLabels":{"tier":"web"}},"policyTypes":["Ingress","Egress"],"ingress":[{},{}],"egress":[{}]}`),
+			linked:     []string{linkKey(web, policy)},
+			unlinked:   []string{linkKey(db, policy)},
+			attributes: map[string]MAP{policy: {"policyTypes": "Ingress,Egress", "ingressRules": "2", "egressRules": "1"}}},
+		// an empty selector selects all the pods in the namespace
+		{event: objectEvent("network_policy", "all", `"spec":{"podSelector":{},"policyTypes":["Ingress"]}`),
+			linked: []string{linkKey(web, all), linkKey(db, all)}},
+		// the policy selects the other pod
+		{event: objectEvent("network_policy", "web",
+			`"spec":{"podSelector":{"matchExpressions":[{"key":"tier","operator":"In","values":["db","cache"]}]}}`),
+			linked:   []string{linkKey(db, policy)},
+			unlinked: []string{linkKey(web, policy)}},
+		// the pod is relabelled to be selected again
+		{event: metadataEvent("pod", "web-1", `"labels":{"tier":"cache"}`, `"spec":{}`),
+			linked: []string{linkKey(web, policy), linkKey(db, policy), linkKey(web, all)}},
+	})
+}
+
+func TestPutAutoscalersAndDisruptionBudgetsLinkTheirTargets(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	deploy, sts := ns1Key(DeploymentNameTag, "web"), ns1Key(StatefulSetNameTag, "db")
+	webScaler, dbScaler := ns1Key(AutoscalerNameTag, "web"), ns1Key(AutoscalerNameTag, "db")
+	pod, pdb := ns1Key(PodNameTag, "web-1"), ns1Key(PodDisruptionBudgetNameTag, "web")
+
+	runPutSteps(t, onix, ox, []putStep{
+		// the autoscaler is recorded before the deployment it scales
+		{event: objectEvent("horizontal_pod_autoscaler", "web",
+			`"spec":{"scaleTargetRef":{"kind":"Deployment","name":"web"},"minReplicas":2,"maxReplicas":5,`+
+				`"metrics":[{"type":"Resource","resource":{"name":"cpu"}},{"type":"Pods","pods":{"metric":{"name":"rps"}}}]},"status":{"currentReplicas":2}`),
+			unlinked: []string{linkKey(webScaler, deploy)},
+			attributes: map[string]MAP{webScaler: {"minReplicas": "2", "maxReplicas": "5", "targetKind": "Deployment", "targetName": "web",
+				"metrics": "Resource:cpu,Pods:rps", "status.currentReplicas": "2"}}},
+		{event: objectEvent("deployment", "web", `"spec":{"replicas":2}`),
+			linked: []string{linkKey(webScaler, deploy)}},
+		{event: objectEvent("stateful_set", "db", `"spec":{"replicas":1}`)},
+		// the autoscaling/v1 format
+		{event: objectEvent("horizontal_pod_autoscaler", "db",
+			`"spec":{"scaleTargetRef":{"kind":"StatefulSet","name":"db"},"maxReplicas":3,"targetCPUUtilizationPercentage":80}`),
+			linked:     []string{linkKey(dbScaler, sts)},
+			unlinked:   []string{linkKey(dbScaler, deploy)},
+			attributes: map[string]MAP{dbScaler: {"metrics": "Resource:cpu"}}},
+		{event: metadataEvent("pod", "web-1", `"labels":{"tier":"web"}`, `"spec":{}`)},
+		{event: objectEvent("pod_disruption_budget", "web",
+			`"spec":{"minAvailable":1,"selector":{"matchLabels":{"tier":"web"}}},"status":{"currentHealthy":2,"disruptionsAllowed":1}`),
+			linked: []string{linkKey(pod, pdb)},
+			attributes: map[string]MAP{pdb: {"minAvailable": "1", "maxUnavailable": "",
+				"status.currentHealthy": "2", "status.disruptionsAllowed": "1"}}},
+		// the budget no longer selects the pod
+		{event: objectEvent("pod_disruption_budget", "web", `"spec":{"maxUnavailable":"50%","selector":{"matchLabels":{"tier":"db"}}}`),
+			unlinked:   []string{linkKey(pod, pdb)},
+			attributes: map[string]MAP{pdb: {"minAvailable": "", "maxUnavailable": "50%"}}},
+	})
+}
+
+func TestPutLimitRangesRecordTheirLimits(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ns, lr, quota := nsKey("test", "ns1"), ns1Key(LimitRangeNameTag, "limits"), ns1Key(ResourceQuotaNameTag, "quota")
+
+	runPutSteps(t, onix, ox, []putStep{
+		{event: objectEvent("limit_range", "limits", `"spec":{"limits":[`+
+			`{"type":"Container","default":{"cpu":"500m","memory":"512Mi"},"defaultRequest":{"cpu":"250m"},"max":{"cpu":"2"}},`+
+			`{"type":"PersistentVolumeClaim","min":{"storage":"1Gi"},"max":{"storage":"10Gi"}}]}`),
+			linked: []string{linkKey(ns, lr)},
+			attributes: map[string]MAP{lr: {"Container.default.cpu": "500m", "Container.default.memory": "512Mi",
+				"Container.defaultRequest.cpu": "250m", "Container.max.cpu": "2",
+				"PersistentVolumeClaim.min.storage": "1Gi", "PersistentVolumeClaim.max.storage": "10Gi"}}},
+		// the limits removed are no longer recorded
+		{event: objectEvent("limit_range", "limits", `"spec":{"limits":[{"type":"Container","maxLimitRequestRatio":{"cpu":"4"}}]}`),
+			linked: []string{linkKey(ns, lr)},
+			attributes: map[string]MAP{lr: {"Container.maxLimitRequestRatio.cpu": "4",
+				"Container.default.cpu": nil, "PersistentVolumeClaim.max.storage": nil}}},
+		// the limit range is recorded alongside the resource quota of the namespace
+		{event: objectEvent("resourcequota", "quota", `"spec":{"hard":{"pods":"10"}}`),
+			linked: []string{linkKey(ns, lr), linkKey(ns, quota)}},
+	})
+}
+
+func TestPutRemovesTheLinksNoLongerReferencedBySpec(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	web, canary, ingress := ns1Key(ServiceNameTag, "web"), ns1Key(ServiceNameTag, "canary"), ns1Key(IngressNameTag, "web")
+	settings, env := ns1Key(ConfigMapNameTag, "settings"), ns1Key(ConfigMapNameTag, "env")
+	creds, tls := ns1Key(SecretNameTag, "creds"), ns1Key(SecretNameTag, "tls")
+	data, logs := ns1Key(PersistentVolumeClaimNameTag, "data"), ns1Key(PersistentVolumeClaimNameTag, "logs")
+	app, other := ns1Key(ServiceAccountNameTag, "app"), ns1Key(ServiceAccountNameTag, "other")
+	pv1, pv2 := clusterItemKey("test", PersistentVolumeNameTag, "pv1"), clusterItemKey("test", PersistentVolumeNameTag, "pv2")
+	fast, slow := clusterItemKey("test", StorageClassNameTag, "fast"), clusterItemKey("test", StorageClassNameTag, "slow")
+	reader, writer, binding := ns1Key(RoleNameTag, "reader"), ns1Key(RoleNameTag, "writer"), ns1Key(RoleBindingNameTag, "app")
+	deploy, sts, hpa := ns1Key(DeploymentNameTag, "web"), ns1Key(StatefulSetNameTag, "db"), ns1Key(AutoscalerNameTag, "web")
+	pod := ns1Key(PodNameTag, "web-1")
+	podSpec := func(claim string, configMap string, secret string, sa string) string {
+		return fmt.Sprintf(`"spec":{"serviceAccountName":"%s","volumes":[{"name":"a","persistentVolumeClaim":{"claimName":"%s"}},`+
+			`{"name":"b","configMap":{"name":"%s"}},{"name":"c","secret":{"secretName":"%s"}}]}`, sa, claim, configMap, secret)
+	}
+
+	steps := []putStep{
+		{event: objectEvent("service", "web", `"spec":{}`)},
+		{event: objectEvent("service", "canary", `"spec":{}`)},
+		{event: objectEvent("ingress", "web", `"spec":{"rules":[{"http":{"paths":[{"path":"/","backend":{"service":{"name":"web"}}},`+
+			`{"path":"/beta","backend":{"service":{"name":"canary"}}}]}}]}`),
+			linked: []string{linkKey(web, ingress), linkKey(canary, ingress)}},
+		// the ingress no longer routes to the canary service
+		{event: objectEvent("ingress", "web", `"spec":{"rules":[{"http":{"paths":[{"path":"/","backend":{"service":{"name":"web"}}}]}}]}`),
+			linked:   []string{linkKey(web, ingress)},
+			unlinked: []string{linkKey(canary, ingress)}},
+	}
+	for _, event := range [][]byte{
+		objectEvent("config_map", "settings", `"data":{}`),
+		objectEvent("config_map", "env", `"data":{}`),
+		objectEvent("secret", "creds", `"data":{}`),
+		objectEvent("secret", "tls", `"data":{}`),
+		objectEvent("persistent_volume_claim", "data", `"spec":{"volumeName":"pv1"}`),
+		objectEvent("persistent_volume_claim", "logs", `"spec":{}`),
+		objectEvent("service_account", "app", `"secrets":[]`),
+		objectEvent("service_account", "other", `"secrets":[]`),
+		clusterEvent("storage_class", "fast", "", `"provisioner":"kubernetes.io/aws-ebs"`),
+		clusterEvent("storage_class", "slow", "", `"provisioner":"kubernetes.io/aws-ebs"`),
+		objectEvent("role", "reader", `"rules":[]`),
+		objectEvent("role", "writer", `"rules":[]`),
+		objectEvent("deployment", "web", `"spec":{"replicas":1}`),
+		objectEvent("stateful_set", "db", `"spec":{"replicas":1}`),
+	} {
+		steps = append(steps, putStep{event: event})
+	}
+	steps = append(steps, []putStep{
+		{event: objectEvent("pod", "web-1", podSpec("data", "settings", "creds", "app")),
+			linked: []string{linkKey(pod, data), linkKey(pod, settings), linkKey(pod, creds), linkKey(pod, app)}},
+		// the pod is recreated with other volumes and service account
+		{event: objectEvent("pod", "web-1", podSpec("logs", "env", "tls", "other")),
+			linked:   []string{linkKey(pod, logs), linkKey(pod, env), linkKey(pod, tls), linkKey(pod, other)},
+			unlinked: []string{linkKey(pod, data), linkKey(pod, settings), linkKey(pod, creds), linkKey(pod, app)}},
+		// the pod keeps the links to the objects it still references
+		{event: objectEvent("pod", "web-1", podSpec("logs", "env", "tls", "other")),
+			linked: []string{linkKey(pod, logs), linkKey(pod, env), linkKey(pod, tls), linkKey(pod, other)}},
+		{event: clusterEvent("persistent_volume", "pv1", "", `"spec":{"storageClassName":"fast","claimRef":{"namespace":"ns1","name":"data"}}`),
+			linked: []string{linkKey(data, pv1), linkKey(pv1, fast)}},
+		{event: clusterEvent("persistent_volume", "pv2", "", `"spec":{"storageClassName":"slow"}`)},
+		// the claim is bound to the other volume
+		{event: objectEvent("persistent_volume_claim", "data", `"spec":{"volumeName":"pv2"}`),
+			linked:   []string{linkKey(data, pv2)},
+			unlinked: []string{linkKey(data, pv1)}},
+		// the volume is bound to another claim and moved to another storage class
+		{event: clusterEvent("persistent_volume", "pv1", "", `"spec":{"storageClassName":"slow","claimRef":{"namespace":"ns1","name":"logs"}}`),
+			linked:   []string{linkKey(logs, pv1), linkKey(pv1, slow), linkKey(data, pv2)},
+			unlinked: []string{linkKey(pv1, fast)}},
+		{event: objectEvent("role_binding", "app", `"roleRef":{"kind":"Role","name":"reader"},"subjects":[{"kind":"ServiceAccount","name":"app","namespace":"ns1"}]`),
+			linked: []string{linkKey(app, binding), linkKey(binding, reader)}},
+		// the binding is recreated for another role and subject
+		{event: objectEvent("role_binding", "app", `"roleRef":{"kind":"Role","name":"writer"},"subjects":[{"kind":"ServiceAccount","name":"other","namespace":"ns1"}]`),
+			linked:   []string{linkKey(other, binding), linkKey(binding, writer)},
+			unlinked: []string{linkKey(app, binding), linkKey(binding, reader)}},
+		{event: objectEvent("horizontal_pod_autoscaler", "web", `"spec":{"scaleTargetRef":{"kind":"Deployment","name":"web"},"maxReplicas":3}`),
+			linked: []string{linkKey(hpa, deploy)}},
+		// the autoscaler scales another controller
+		{event: objectEvent("horizontal_pod_autoscaler", "web", `"spec":{"scaleTargetRef":{"kind":"StatefulSet","name":"db"},"maxReplicas":3}`),
+			linked:   []string{linkKey(hpa, sts)},
+			unlinked: []string{linkKey(hpa, deploy)}},
+	}...)
+	runPutSteps(t, onix, ox, steps)
+}
@@ -0,0 +1,225 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+package main
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strconv"
+)
+
+// the item status codes reflecting the health of K8S objects
+const (
+	// the health of the object is not known or not recorded
+	StatusUnknown = 0
+	// the object is running and ready (e.g. a ready pod or a bound claim)
+	StatusReady = 1
+	// the object is being created or updated (e.g. a pending pod or a rollout in progress)
+	StatusPending = 2
+	// the object is running but not ready (e.g. a pod failing its readiness probe)
+	StatusNotReady = 3
+	// the object has failed (e.g. a failed pod or job, or a lost claim)
+	StatusFailed = 4
+	// the object has run to completion (e.g. a succeeded pod or job)
+	StatusCompleted = 5
+	// the object has been deleted and its item kept for auditing purposes
+	StatusRetired = 6
+)
+
+// the functions setting the status code and status attributes of an item by item type
+// the attributes are prefixed with the field of the object they come from (e.g. status.phase)
+// so that they cannot be mistaken for, or overwrite, labels with the same name
+var statusMappers = map[string]func(status gjson.Result, item *Item){
+	K8SPod:                   podStatus,
+	K8SDeployment:            replicaStatus,
+	K8SReplicaSet:            replicaStatus,
+	K8SStatefulSet:           replicaStatus,
+	K8SReplicationController: replicaStatus,
+	K8SDaemonSet:             daemonSetStatus,
+	K8SJob:                   jobStatus,
+	K8SPersistentVolumeClaim: phaseStatus,
+	K8SPersistentVolume:      phaseStatus,
+	K8SNode:                  nodeStatus,
+}
+
+// sets the status code and status attributes of the item from the status of the K8S object
+func addStatus(event []byte, item *Item) {
+	if mapper, ok := statusMappers[item.Type]; ok {
+		mapper(gjson.GetBytes(event, "Object"), item)
+	}
+}
+
+// maps the pod phase, readiness and container restarts
+func podStatus(object gjson.Result, item *Item) {
+	status := object.Get("status")
+	phase := status.Get("phase").String()
+	ready := conditionStatus(status, "Ready") == "True"
+	var readyContainers, containers, restarts int64
+	for _, container := range status.Get("containerStatuses").Array() {
+		containers++
+		if container.Get("ready").Bool() {
+			readyContainers++
+		}
+		restarts += container.Get("restartCount").Int()
+	}
+	for _, container := range status.Get("initContainerStatuses").Array() {
+		restarts += container.Get("restartCount").Int()
+	}
+	item.Attribute["status.phase"] = phase
+	item.Attribute["status.ready"] = strconv.FormatBool(ready)
+	item.Attribute["status.readyContainers"] = fmt.Sprintf("%d/%d", readyContainers, containers)
+	item.Attribute["status.restarts"] = strconv.FormatInt(restarts, 10)
+	switch phase {
+	case "Pending":
+		item.Status = StatusPending
+	case "Running":
+		if ready {
+			item.Status = StatusReady
+		} else {
+			item.Status = StatusNotReady
+		}
+	case "Succeeded":
+		item.Status = StatusCompleted
+	case "Failed":
+		item.Status = StatusFailed
+	default:
+		item.Status = StatusUnknown
+	}
+}
+
+// maps the status of a container in a pod
+func containerStatus(status gjson.Result, item *Item) {
+	if !status.Exists() {
+		item.Status = StatusUnknown
+		return
+	}
+	ready := status.Get("ready").Bool()
+	item.Attribute["status.ready"] = strconv.FormatBool(ready)
+	item.Attribute["status.restarts"] = status.Get("restartCount").String()
+	switch {
+	case status.Get("state.running").Exists():
+		item.Attribute["status.state"] = "running"
+		if ready {
+			item.Status = StatusReady
+		} else {
+			item.Status = StatusNotReady
+		}
+	case status.Get("state.waiting").Exists():
+		item.Attribute["status.state"] = "waiting"
+		item.Attribute["status.reason"] = status.Get("state.waiting.reason").String()
+		item.Status = StatusPending
+	case status.Get("state.terminated").Exists():
+		item.Attribute["status.state"] = "terminated"
+		item.Attribute["status.reason"] = status.Get("state.terminated.reason").String()
+		if status.Get("state.terminated.exitCode").Int() == 0 {
+			item.Status = StatusCompleted
+		} else {
+			item.Status = StatusFailed
+		}
+	default:
+		item.Status = StatusUnknown
+	}
+}
+
+// maps the desired and ready replicas of a controller
+func replicaStatus(object gjson.Result, item *Item) {
+	status := object.Get("status")
+	// the desired replicas default to one if not specified
+	desired := int64(1)
+	if replicas := object.Get("spec.replicas"); replicas.Exists() {
+		desired = replicas.Int()
+	}
+	item.Attribute["spec.replicas"] = strconv.FormatInt(desired, 10)
+	item.Attribute["status.readyReplicas"] = strconv.FormatInt(status.Get("readyReplicas").Int(), 10)
+	item.Attribute["status.availableReplicas"] = strconv.FormatInt(status.Get("availableReplicas").Int(), 10)
+	item.Attribute["status.updatedReplicas"] = strconv.FormatInt(status.Get("updatedReplicas").Int(), 10)
+	item.Status = readiness(status.Get("readyReplicas").Int(), desired)
+}
+
+// maps the desired and ready pods of a daemon set
+func daemonSetStatus(object gjson.Result, item *Item) {
+	status := object.Get("status")
+	desired := status.Get("desiredNumberScheduled").Int()
+	item.Attribute["status.desiredNumberScheduled"] = strconv.FormatInt(desired, 10)
+	item.Attribute["status.numberReady"] = strconv.FormatInt(status.Get("numberReady").Int(), 10)
+	item.Attribute["status.numberAvailable"] = strconv.FormatInt(status.Get("numberAvailable").Int(), 10)
+	item.Status = readiness(status.Get("numberReady").Int(), desired)
+}
+
+// gets the status code of a controller from its ready and desired pods
+func readiness(ready int64, desired int64) int {
+	switch {
+	case ready >= desired:
+		return StatusReady
+	case ready == 0:
+		return StatusNotReady
+	default:
+		return StatusPending
+	}
+}
+
+// maps the completion of a job
+func jobStatus(object gjson.Result, item *Item) {
+	status := object.Get("status")
+	switch {
+	case conditionStatus(status, "Complete") == "True":
+		item.Status = StatusCompleted
+	case conditionStatus(status, "Failed") == "True":
+		item.Status = StatusFailed
+	default:
+		item.Status = StatusPending
+	}
+}
+
+// maps the phase of a persistent volume or claim
+func phaseStatus(object gjson.Result, item *Item) {
+	switch object.Get("status.phase").String() {
+	case "Bound", "Available":
+		item.Status = StatusReady
+	case "Pending", "Released":
+		item.Status = StatusPending
+	case "Lost", "Failed":
+		item.Status = StatusFailed
+	default:
+		item.Status = StatusUnknown
+	}
+}
+
+// maps the conditions of a node
+func nodeStatus(object gjson.Result, item *Item) {
+	status := object.Get("status")
+	for _, condition := range status.Get("conditions").Array() {
+		item.Attribute[fmt.Sprintf("status.condition.%s", condition.Get("type").String())] = condition.Get("status").String()
+	}
+	item.Attribute["spec.unschedulable"] = strconv.FormatBool(object.Get("spec.unschedulable").Bool())
+	switch conditionStatus(status, "Ready") {
+	case "True":
+		item.Status = StatusReady
+	case "False":
+		item.Status = StatusNotReady
+	default:
+		item.Status = StatusUnknown
+	}
+}
+
+// gets the status (True, False or Unknown) of a condition of the passed-in type
+func conditionStatus(status gjson.Result, conditionType string) string {
+	for _, condition := range status.Get("conditions").Array() {
+		if condition.Get("type").String() == conditionType {
+			return condition.Get("status").String()
+		}
+	}
+	return ""
+}
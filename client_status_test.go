@@ -0,0 +1,83 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStatusAttributesDoNotOverwriteLabels(t *testing.T) {
+	event := []byte(`{"Change":{"kind":"pod","type":"create","name":"web","namespace":"ns1","host":"test"},` +
+		`"Object":{"metadata":{"labels":{"phase":"beta","ready":"no","restarts":"never"}},"spec":{},` +
+		`"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}],"containerStatuses":[{"ready":true,"restartCount":2}]}}}`)
+	pod, err := item(event, K8SPod, PodNameTag)
+	if err != nil {
+		t.Fatalf("failed to get the pod item: %s", err)
+	}
+	expected := map[string]string{
+		"phase":                  "beta",
+		"ready":                  "no",
+		"restarts":               "never",
+		"status.phase":           "Running",
+		"status.ready":           "true",
+		"status.readyContainers": "1/1",
+		"status.restarts":        "2",
+	}
+	for name, value := range expected {
+		if pod.Attribute[name] != value {
+			t.Errorf("expected attribute %s to be '%s', got '%v'", name, value, pod.Attribute[name])
+		}
+	}
+	if pod.Status != StatusReady {
+		t.Errorf("expected status %d, got %d", StatusReady, pod.Status)
+	}
+}
+
+func TestLabelsDoNotOverwriteCoreAttributes(t *testing.T) {
+	event := []byte(`{"Change":{"kind":"config_map","type":"create","name":"app","namespace":"ns1","host":"test"},` +
+		`"Object":{"metadata":{"resourceVersion":"7","labels":{"cluster":"other","namespace":"ns2"},"annotations":{"resourceVersion":"1"}}}}`)
+	cm, err := item(event, K8SConfigMap, ConfigMapNameTag)
+	if err != nil {
+		t.Fatalf("failed to get the config map item: %s", err)
+	}
+	for name, value := range map[string]string{"cluster": "test", "namespace": "ns1", "resourceVersion": "7"} {
+		if cm.Attribute[name] != value {
+			t.Errorf("expected attribute %s to be '%s', got '%v'", name, value, cm.Attribute[name])
+		}
+	}
+}
+
+func TestNodeConditionsAreRecordedOnce(t *testing.T) {
+	event := []byte(`{"Change":{"kind":"node","type":"create","name":"node1","host":"test"},` +
+		`"Object":{"metadata":{},"status":{"conditions":[{"type":"Ready","status":"True"},{"type":"DiskPressure","status":"False"}]}}}`)
+	node, err := nodeItem(event)
+	if err != nil {
+		t.Fatalf("failed to get the node item: %s", err)
+	}
+	var conditions []string
+	for name := range node.Attribute {
+		if strings.Contains(name, "condition") {
+			conditions = append(conditions, name)
+		}
+	}
+	sort.Strings(conditions)
+	if fmt.Sprint(conditions) != "[status.condition.DiskPressure status.condition.Ready]" {
+		t.Errorf("expected a status attribute per condition, got %v", conditions)
+	}
+}
@@ -106,3 +106,21 @@ func GetJSONBytesReader(data interface{}) (*bytes.Reader, error) {
 func check(result *Result, err error) bool {
 	return err != nil || (result != nil && result.Error)
 }
+
+// checks if the slice contains the passed-in value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// appends a non empty value to the slice if it is not already in it
+func appendUnique(values []string, value string) []string {
+	if len(value) == 0 || contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
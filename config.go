@@ -15,15 +15,22 @@
 
 package main
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 import "github.com/spf13/viper"
 import log "github.com/sirupsen/logrus"
 
 type Config struct {
-	LogLevel  string
-	Id        string
-	Onix      Onix
-	Consumers Consumers
+	LogLevel        string
+	Id              string
+	Onix            Onix
+	Consumers       Consumers
+	Cascade         CascadeConf
+	Retirement      RetirementConf
+	Reconcile       ReconcileConf
+	CustomResources []CustomResourceConf
 }
 
 type Onix struct {
@@ -40,6 +47,8 @@ type Consumers struct {
 	Consumer string
 	Webhook  WebhookConf
 	Broker   BrokerConf
+	Kafka    KafkaConf
+	Kube     KubeConf
 }
 
 type WebhookConf struct {
@@ -52,6 +61,92 @@ type WebhookConf struct {
 }
 
 type BrokerConf struct {
+	URL          string
+	Exchange     string
+	ExchangeType string
+	Queue        string
+	RoutingKey   string
+	Prefetch     int
+	TLS          TLSConf
+}
+
+type KafkaConf struct {
+	Brokers       string
+	Topic         string
+	GroupId       string
+	Version       string
+	InitialOffset string
+	TLS           TLSConf
+}
+
+type KubeConf struct {
+	Kubeconfig string
+	Cluster    string
+}
+
+// the deletion of the items left in the CMDB when their namespace or controller is deleted
+type CascadeConf struct {
+	Namespace  bool
+	Controller bool
+}
+
+// the retirement of items on delete events instead of deleting them from the CMDB
+type RetirementConf struct {
+	Enabled bool
+	// the age of the retired items deleted by the retention sweep, zero keeps them forever
+	Retention time.Duration
+	// the interval between retention sweeps
+	Interval time.Duration
+}
+
+// the periodic reconciliation of the items in the CMDB with a full list of the objects in a cluster
+type ReconcileConf struct {
+	Enabled  bool
+	Interval time.Duration
+	// where the objects are listed from (i.e. kube or snapshot)
+	Source string
+	// the path to a kubeconfig file, if empty the pod service account is used
+	Kubeconfig string
+	// the path to a Sentinel snapshot file holding a JSON array of events
+	Snapshot string
+	// the name of the cluster whose items are reconciled
+	Cluster string
+}
+
+// the mapping of a custom resource to an item type recorded by the generic handler
+type CustomResourceConf struct {
+	Kind          string
+	Path          string
+	ItemType      string
+	Name          string
+	Description   string
+	Tag           string
+	ClusterScoped bool
+	Ownable       bool
+	Attributes    []CustomAttributeConf
+	Links         []CustomLinkConf
+}
+
+// an item attribute of a custom resource read from the event using a gjson path
+type CustomAttributeConf struct {
+	Name string
+	Path string
+}
+
+// a link from a custom resource to the items named by a gjson path in the event
+type CustomLinkConf struct {
+	ItemType    string
+	Tag         string
+	Path        string
+	Description string
+}
+
+type TLSConf struct {
+	Enabled            bool
+	CACert             string
+	Cert               string
+	Key                string
+	InsecureSkipVerify bool
 }
 
 func NewConfig() (Config, error) {
@@ -90,6 +185,40 @@ func NewConfig() (Config, error) {
 	_ = v.BindEnv("Consumers.Webhook.Username")
 	_ = v.BindEnv("Consumers.Webhook.Password")
 	_ = v.BindEnv("Consumers.Webhook.Metrics")
+	_ = v.BindEnv("Consumers.Broker.URL")
+	_ = v.BindEnv("Consumers.Broker.Exchange")
+	_ = v.BindEnv("Consumers.Broker.ExchangeType")
+	_ = v.BindEnv("Consumers.Broker.Queue")
+	_ = v.BindEnv("Consumers.Broker.RoutingKey")
+	_ = v.BindEnv("Consumers.Broker.Prefetch")
+	_ = v.BindEnv("Consumers.Broker.TLS.Enabled")
+	_ = v.BindEnv("Consumers.Broker.TLS.CACert")
+	_ = v.BindEnv("Consumers.Broker.TLS.Cert")
+	_ = v.BindEnv("Consumers.Broker.TLS.Key")
+	_ = v.BindEnv("Consumers.Broker.TLS.InsecureSkipVerify")
+	_ = v.BindEnv("Consumers.Kafka.Brokers")
+	_ = v.BindEnv("Consumers.Kafka.Topic")
+	_ = v.BindEnv("Consumers.Kafka.GroupId")
+	_ = v.BindEnv("Consumers.Kafka.Version")
+	_ = v.BindEnv("Consumers.Kafka.InitialOffset")
+	_ = v.BindEnv("Consumers.Kafka.TLS.Enabled")
+	_ = v.BindEnv("Consumers.Kafka.TLS.CACert")
+	_ = v.BindEnv("Consumers.Kafka.TLS.Cert")
+	_ = v.BindEnv("Consumers.Kafka.TLS.Key")
+	_ = v.BindEnv("Consumers.Kafka.TLS.InsecureSkipVerify")
+	_ = v.BindEnv("Consumers.Kube.Kubeconfig")
+	_ = v.BindEnv("Consumers.Kube.Cluster")
+	_ = v.BindEnv("Cascade.Namespace")
+	_ = v.BindEnv("Cascade.Controller")
+	_ = v.BindEnv("Retirement.Enabled")
+	_ = v.BindEnv("Retirement.Retention")
+	_ = v.BindEnv("Retirement.Interval")
+	_ = v.BindEnv("Reconcile.Enabled")
+	_ = v.BindEnv("Reconcile.Interval")
+	_ = v.BindEnv("Reconcile.Source")
+	_ = v.BindEnv("Reconcile.Kubeconfig")
+	_ = v.BindEnv("Reconcile.Snapshot")
+	_ = v.BindEnv("Reconcile.Cluster")
 
 	// creates a config struct and populate it with values
 	c := new(Config)
@@ -111,6 +240,47 @@ func NewConfig() (Config, error) {
 	c.Consumers.Webhook.Username = v.GetString("Consumers.Webhook.Username")
 	c.Consumers.Webhook.Password = v.GetString("Consumers.Webhook.Password")
 	c.Consumers.Webhook.Metrics = v.GetBool("Consumers.Webhook.Metrics")
+	c.Consumers.Broker.URL = v.GetString("Consumers.Broker.URL")
+	c.Consumers.Broker.Exchange = v.GetString("Consumers.Broker.Exchange")
+	c.Consumers.Broker.ExchangeType = v.GetString("Consumers.Broker.ExchangeType")
+	c.Consumers.Broker.Queue = v.GetString("Consumers.Broker.Queue")
+	c.Consumers.Broker.RoutingKey = v.GetString("Consumers.Broker.RoutingKey")
+	c.Consumers.Broker.Prefetch = v.GetInt("Consumers.Broker.Prefetch")
+	c.Consumers.Broker.TLS.Enabled = v.GetBool("Consumers.Broker.TLS.Enabled")
+	c.Consumers.Broker.TLS.CACert = v.GetString("Consumers.Broker.TLS.CACert")
+	c.Consumers.Broker.TLS.Cert = v.GetString("Consumers.Broker.TLS.Cert")
+	c.Consumers.Broker.TLS.Key = v.GetString("Consumers.Broker.TLS.Key")
+	c.Consumers.Broker.TLS.InsecureSkipVerify = v.GetBool("Consumers.Broker.TLS.InsecureSkipVerify")
+	c.Consumers.Kafka.Brokers = v.GetString("Consumers.Kafka.Brokers")
+	c.Consumers.Kafka.Topic = v.GetString("Consumers.Kafka.Topic")
+	c.Consumers.Kafka.GroupId = v.GetString("Consumers.Kafka.GroupId")
+	c.Consumers.Kafka.Version = v.GetString("Consumers.Kafka.Version")
+	c.Consumers.Kafka.InitialOffset = v.GetString("Consumers.Kafka.InitialOffset")
+	c.Consumers.Kafka.TLS.Enabled = v.GetBool("Consumers.Kafka.TLS.Enabled")
+	c.Consumers.Kafka.TLS.CACert = v.GetString("Consumers.Kafka.TLS.CACert")
+	c.Consumers.Kafka.TLS.Cert = v.GetString("Consumers.Kafka.TLS.Cert")
+	c.Consumers.Kafka.TLS.Key = v.GetString("Consumers.Kafka.TLS.Key")
+	c.Consumers.Kafka.TLS.InsecureSkipVerify = v.GetBool("Consumers.Kafka.TLS.InsecureSkipVerify")
+	c.Consumers.Kube.Kubeconfig = v.GetString("Consumers.Kube.Kubeconfig")
+	c.Consumers.Kube.Cluster = v.GetString("Consumers.Kube.Cluster")
+	c.Cascade.Namespace = v.GetBool("Cascade.Namespace")
+	c.Cascade.Controller = v.GetBool("Cascade.Controller")
+	c.Retirement.Enabled = v.GetBool("Retirement.Enabled")
+	c.Retirement.Retention = v.GetDuration("Retirement.Retention")
+	c.Retirement.Interval = v.GetDuration("Retirement.Interval")
+	c.Reconcile.Enabled = v.GetBool("Reconcile.Enabled")
+	c.Reconcile.Interval = v.GetDuration("Reconcile.Interval")
+	c.Reconcile.Source = v.GetString("Reconcile.Source")
+	c.Reconcile.Kubeconfig = v.GetString("Reconcile.Kubeconfig")
+	c.Reconcile.Snapshot = v.GetString("Reconcile.Snapshot")
+	c.Reconcile.Cluster = v.GetString("Reconcile.Cluster")
+
+	// custom resource mappings (tables cannot be set using environment variables)
+	err = v.UnmarshalKey("CustomResources", &c.CustomResources)
+	if err != nil {
+		log.Errorf("Failed to read custom resources configuration: %s", err)
+		return Config{}, err
+	}
 
 	return *c, nil
 }
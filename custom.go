@@ -0,0 +1,175 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+)
+
+// registers a generic handler for each of the custom resources in the configuration
+// and adds the ones with an API server path to the resources watched by the kube consumer
+// the custom resources cannot reuse the kind, tag or item type of other resources, as their items
+// would share keys, handlers and link rules
+func registerCustomResources(resources []CustomResourceConf) error {
+	tags := map[string]bool{EndpointsNameTag: true, ContainerNameTag: true, ImageNameTag: true}
+	for _, resource := range kubeResources {
+		tags[resource.tag] = true
+	}
+	itemTypes := map[string]bool{K8SCluster: true, K8SImage: true}
+	for _, itemType := range namespacedTypes {
+		itemTypes[string(itemType)] = true
+	}
+	for _, itemType := range clusterTypes {
+		itemTypes[string(itemType)] = true
+	}
+	for _, resource := range resources {
+		if len(resource.Kind) == 0 || len(resource.ItemType) == 0 || len(resource.Tag) == 0 {
+			return fmt.Errorf("custom resource '%s' requires a kind, an item type and a tag", resource.Name)
+		}
+		if _, ok := Handlers.Get(resource.Kind); ok {
+			return fmt.Errorf("custom resource '%s' kind '%s' is already recorded", resource.Name, resource.Kind)
+		}
+		if tags[resource.Tag] {
+			return fmt.Errorf("custom resource '%s' tag '%s' is already used", resource.Name, resource.Tag)
+		}
+		if itemTypes[resource.ItemType] {
+			return fmt.Errorf("custom resource '%s' item type '%s' is already used", resource.Name, resource.ItemType)
+		}
+		tags[resource.Tag] = true
+		itemTypes[resource.ItemType] = true
+		if resource.ClusterScoped {
+			clusterScoped[resource.Tag] = true
+			clusterTypes = append(clusterTypes, K8SOBJ(resource.ItemType))
+		} else {
+			namespacedTypes = append(namespacedTypes, K8SOBJ(resource.ItemType))
+		}
+		if resource.Ownable {
+			ownedTypes = append(ownedTypes, K8SOBJ(resource.ItemType))
+		}
+		itemBuilders[resource.Kind] = customResourceItem(resource)
+		Handlers.Register(resource.Kind, ItemHandler(putCustomResource(resource), keyOf(resource.Tag)))
+		if len(resource.Path) > 0 {
+			kubeResources = append(kubeResources, kubeResource{kind: resource.Kind, path: resource.Path, itemType: K8SOBJ(resource.ItemType), tag: resource.Tag})
+		}
+	}
+	return nil
+}
+
+// adds the item types and link rules of the custom resources to the meta model
+func addCustomResourceTypes(data *Data, resources []CustomResourceConf) {
+	for _, resource := range resources {
+		data.ItemTypes = append(data.ItemTypes, ItemType{
+			Key:         resource.ItemType,
+			Name:        resource.Name,
+			Description: resource.Description,
+			Model:       K8SModel,
+		})
+		// custom resources are linked to their namespace or cluster
+		parent, parentName := K8SNamespace, "namespace"
+		if resource.ClusterScoped {
+			parent, parentName = K8SCluster, "cluster"
+		}
+		data.LinkRules = append(data.LinkRules, LinkRule{
+			Key:              fmt.Sprintf("%s->%s", parent, resource.ItemType),
+			Name:             fmt.Sprintf("K8S %s to %s Rule", parent, resource.ItemType),
+			Description:      fmt.Sprintf("A %s is defined in a %s.", resource.Name, parentName),
+			LinkTypeKey:      K8SLink,
+			StartItemTypeKey: parent,
+			EndItemTypeKey:   resource.ItemType,
+		})
+		for _, link := range resource.Links {
+			data.LinkRules = append(data.LinkRules, LinkRule{
+				Key:              fmt.Sprintf("%s->%s", resource.ItemType, link.ItemType),
+				Name:             fmt.Sprintf("K8S %s to %s Rule", resource.ItemType, link.ItemType),
+				Description:      link.Description,
+				LinkTypeKey:      K8SLink,
+				StartItemTypeKey: resource.ItemType,
+				EndItemTypeKey:   link.ItemType,
+			})
+		}
+	}
+}
+
+// creates a function building the item of a custom resource using the passed-in mapping
+func customResourceItem(resource CustomResourceConf) func(event []byte) (*Item, error) {
+	return func(event []byte) (*Item, error) {
+		item, err := item(event, resource.ItemType, resource.Tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range resource.Attributes {
+			item.Attribute[attr.Name] = gjson.GetBytes(event, attr.Path).String()
+		}
+		return item, nil
+	}
+}
+
+// creates a function recording a custom resource in the CMDB using the passed-in mapping
+func putCustomResource(resource CustomResourceConf) HandlerFunc {
+	build := customResourceItem(resource)
+	return func(c *Client, event []byte) (*Result, error) {
+		// gets the custom resource item information
+		item, err := build(event)
+		if err != nil {
+			c.Log.Errorf("Failed to get %s information: %s.", resource.Kind, err)
+			return nil, err
+		}
+
+		// push the item to the CMDB under its cluster or namespace
+		var result *Result
+		if resource.ClusterScoped {
+			result, err = c.putInCluster(event, item)
+		} else {
+			_, result, err = c.putResource(item, "item")
+			if check(result, err) {
+				return result, err
+			}
+			_, result, err = c.putResource(c.getLink(NS(event), item.Key), "link")
+		}
+		if check(result, err) {
+			return result, err
+		}
+
+		// link the custom resource with the items it refers to, the items might
+		// not have been recorded yet, in which case the link is created when it changes again
+		for _, link := range resource.Links {
+			for _, name := range gjson.GetBytes(event, link.Path).Array() {
+				key, err := linkedItemKey(item, link.Tag, name.String())
+				if err != nil {
+					c.Log.Errorf("Failed to link %s: %s.", item.Key, err)
+					return nil, err
+				}
+				_, _ = c.linkIfExists(item.Key, key)
+			}
+		}
+		return result, err
+	}
+}
+
+// gets the key of an item with the passed-in name tag and name
+// in the cluster and namespace of the passed-in item
+func linkedItemKey(item *Item, tag string, name string) (string, error) {
+	cluster, ok := item.Attribute["cluster"].(string)
+	if !ok {
+		return "", fmt.Errorf("item %s has no cluster", item.Key)
+	}
+	if clusterScoped[tag] {
+		return clusterItemKey(cluster, tag, name), nil
+	}
+	namespace, _ := item.Attribute["namespace"].(string)
+	return fmt.Sprintf("%s-%s-%s", nsKey(cluster, namespace), tag, name), nil
+}
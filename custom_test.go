@@ -0,0 +1,180 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// the kafka custom resource of the example configuration
+var kafkaResource = CustomResourceConf{
+	Kind:        "kafka",
+	Path:        "/apis/kafka.strimzi.io/v1beta2/kafkas",
+	ItemType:    "K8S_KAFKA",
+	Name:        "Kafka Cluster",
+	Description: "A Kafka cluster managed by the Strimzi operator.",
+	Tag:         "kafka",
+	Ownable:     true,
+	Attributes:  []CustomAttributeConf{{Name: "version", Path: "Object.spec.kafka.version"}},
+	Links:       []CustomLinkConf{{ItemType: K8SSecret, Tag: SecretNameTag, Path: "Object.spec.clientsCa.secretName"}},
+}
+
+// keeps the resources registered out of the box, returning the function restoring them
+// after the custom resources registered by a test
+func keepRegisteredResources() func() {
+	handlers := Handlers
+	Handlers = NewRegistry()
+	for kind, handler := range handlers.handlers {
+		Handlers.handlers[kind] = handler
+	}
+	resources, namespaced, cluster, owned := kubeResources, namespacedTypes, clusterTypes, ownedTypes
+	scoped := make(map[string]bool)
+	for tag, value := range clusterScoped {
+		scoped[tag] = value
+	}
+	builders := make(map[string]func(event []byte) (*Item, error))
+	for kind, builder := range itemBuilders {
+		builders[kind] = builder
+	}
+	return func() {
+		Handlers = handlers
+		kubeResources, namespacedTypes, clusterTypes, ownedTypes = resources, namespaced, cluster, owned
+		clusterScoped, itemBuilders = scoped, builders
+	}
+}
+
+func TestRegisterCustomResources(t *testing.T) {
+	defer keepRegisteredResources()()
+
+	if err := registerCustomResources([]CustomResourceConf{kafkaResource}); err != nil {
+		t.Fatalf("failed to register the custom resource: %s", err)
+	}
+	if _, ok := Handlers.Get("kafka"); !ok {
+		t.Errorf("expected a handler to be registered for the custom resource")
+	}
+	if _, ok := itemBuilders["kafka"]; !ok {
+		t.Errorf("expected an item builder to be registered for the custom resource")
+	}
+	if resource, ok := manifestResource("Kafka"); !ok || resource.path != kafkaResource.Path || resource.tag != "kafka" {
+		t.Errorf("expected the custom resource to be watched by the kube consumer, got %v", resource)
+	}
+	contains := func(types []K8SOBJ) bool {
+		for _, itemType := range types {
+			if itemType == "K8S_KAFKA" {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(namespacedTypes) || contains(clusterTypes) || !contains(ownedTypes) {
+		t.Errorf("expected the custom resource to be an ownable namespaced type")
+	}
+}
+
+func TestCustomResourcesAreRecordedUsingTheirMapping(t *testing.T) {
+	defer keepRegisteredResources()()
+	if err := registerCustomResources([]CustomResourceConf{kafkaResource}); err != nil {
+		t.Fatalf("failed to register the custom resource: %s", err)
+	}
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+	ns := nsKey("test", "ns1")
+	onix.items[ns] = Item{Key: ns, Name: "ns1", Type: K8SNamespace, Attribute: MAP{"cluster": "test"}}
+	secret := ns + "-" + SecretNameTag + "-ca"
+	onix.items[secret] = Item{Key: secret, Name: "ca", Type: K8SSecret, Attribute: MAP{"cluster": "test", "namespace": "ns1"}}
+
+	result, err := ox.process(objectEvent("kafka", "events", `"spec":{"kafka":{"version":"3.6.0"},"clientsCa":{"secretName":"ca"}}`))
+	if check(result, err) {
+		t.Fatalf("failed to record the custom resource: %v %v", result, err)
+	}
+	key := ns + "-kafka-events"
+	kafka, ok := onix.items[key]
+	if !ok {
+		t.Fatalf("expected the custom resource to be recorded as %s", key)
+	}
+	if kafka.Type != "K8S_KAFKA" || kafka.Attribute["version"] != "3.6.0" {
+		t.Errorf("expected a K8S_KAFKA item with the mapped version attribute, got %s %v", kafka.Type, kafka.Attribute)
+	}
+	for _, end := range []string{key, secret} {
+		start := ns
+		if end == secret {
+			start = key
+		}
+		if links := onix.linksTo(end); len(links) != 1 || onix.links[links[0]].StartItemKey != start {
+			t.Errorf("expected %s to be linked to %s, got %v", start, end, links)
+		}
+	}
+}
+
+func TestRegisterCustomResourcesRejectsReusedNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(resource *CustomResourceConf)
+		expected string
+	}{
+		{"no tag", func(r *CustomResourceConf) { r.Tag = "" }, "requires"},
+		{"built-in kind", func(r *CustomResourceConf) { r.Kind = "pod" }, "kind 'pod'"},
+		{"built-in kind in another case", func(r *CustomResourceConf) { r.Kind = "POD" }, "kind 'POD'"},
+		{"built-in tag", func(r *CustomResourceConf) { r.Tag = PodNameTag }, "tag 'pod'"},
+		{"tag of items not watched", func(r *CustomResourceConf) { r.Tag = ContainerNameTag }, "tag 'container'"},
+		{"built-in item type", func(r *CustomResourceConf) { r.ItemType = K8SPod }, "item type 'K8S_POD'"},
+		{"cluster item type", func(r *CustomResourceConf) { r.ItemType = K8SCluster }, "item type 'K8S_CL'"},
+	}
+	for _, c := range cases {
+		restore := keepRegisteredResources()
+		resource := kafkaResource
+		c.modify(&resource)
+		err := registerCustomResources([]CustomResourceConf{resource})
+		restore()
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s: expected an error about %s, got %v", c.name, c.expected, err)
+		}
+	}
+
+	// the custom resources cannot reuse each other's names either
+	duplicates := []struct {
+		name   string
+		modify func(resource *CustomResourceConf)
+	}{
+		{"kind", func(r *CustomResourceConf) { r.Tag, r.ItemType = "kafka2", "K8S_KAFKA2" }},
+		{"tag", func(r *CustomResourceConf) { r.Kind, r.ItemType = "kafka2", "K8S_KAFKA2" }},
+		{"item type", func(r *CustomResourceConf) { r.Kind, r.Tag = "kafka2", "kafka2" }},
+	}
+	for _, d := range duplicates {
+		restore := keepRegisteredResources()
+		resource := kafkaResource
+		d.modify(&resource)
+		err := registerCustomResources([]CustomResourceConf{kafkaResource, resource})
+		restore()
+		if err == nil {
+			t.Errorf("expected an error registering two custom resources with the same %s", d.name)
+		}
+	}
+}
+
+func TestLinkedItemKeyRequiresTheCluster(t *testing.T) {
+	item := &Item{Key: "k8s-test-ns-ns1-kafka-events", Attribute: MAP{"namespace": "ns1"}}
+	if _, err := linkedItemKey(item, SecretNameTag, "ca"); err == nil {
+		t.Errorf("expected an error getting a linked key of an item without a cluster")
+	}
+	item.Attribute["cluster"] = "test"
+	key, err := linkedItemKey(item, SecretNameTag, "ca")
+	if err != nil || key != "k8s-test-ns-ns1-secret-ca" {
+		t.Errorf("expected the key of the secret in the namespace, got %s %v", key, err)
+	}
+}
@@ -0,0 +1,276 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// the kinds of object whose Sentinel kind is not the kind in snake case
+var manifestKinds = map[string]string{
+	"ResourceQuota": "resourcequota",
+}
+
+// the drift found between a cluster and the CMDB
+type DriftReport struct {
+	Cluster  string  `json:"cluster"`
+	Missing  int     `json:"missing"`
+	Changed  int     `json:"changed"`
+	Orphaned int     `json:"orphaned"`
+	Drifts   []Drift `json:"drifts"`
+}
+
+// runs the drift command comparing the objects in a directory of manifests or a live cluster
+// with the items in the CMDB without writing to it
+// returns 0 if there is no drift, 1 if there is drift and 2 if the comparison failed
+func drift(args []string) int {
+	flags := flag.NewFlagSet("drift", flag.ContinueOnError)
+	manifests := flags.String("manifests", "", "the directory of exported manifests, compared with the items of their kinds and namespaces only, if empty the live cluster is compared")
+	kubeconfig := flags.String("kubeconfig", "", "the path to a kubeconfig file for the live cluster, if empty the pod service account is used")
+	cluster := flags.String("cluster", "", "the name of the cluster in the CMDB, defaults to the reconciled or kube consumer cluster")
+	output := flags.String("output", "text", "the output format (i.e. text or json)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	report, err := driftReport(*manifests, *kubeconfig, *cluster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drift: %s\n", err)
+		return 2
+	}
+	switch *output {
+	case "json":
+		err = report.writeJSON(os.Stdout)
+	case "text":
+		err = report.writeText(os.Stdout)
+	default:
+		err = fmt.Errorf("output '%s' is not implemented", *output)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drift: %s\n", err)
+		return 2
+	}
+	if len(report.Drifts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// compares the objects in the manifests directory or the live cluster with the items in the CMDB
+func driftReport(manifests string, kubeconfig string, cluster string) (*DriftReport, error) {
+	k := OxKube{}
+	if err := k.loadConfig(); err != nil {
+		return nil, err
+	}
+	if err := registerCustomResources(k.config.CustomResources); err != nil {
+		return nil, err
+	}
+	client, err := NewClient(k.log, k.config)
+	if err != nil {
+		return nil, err
+	}
+	if len(cluster) == 0 {
+		cluster = k.config.Reconcile.Cluster
+	}
+	if len(cluster) == 0 {
+		cluster = k.config.Consumers.Kube.Cluster
+	}
+	r := &Reconciler{
+		log:    k.log,
+		config: ReconcileConf{Source: "kube", Kubeconfig: kubeconfig, Cluster: cluster},
+		ox:     client,
+	}
+	var objects map[string][][]byte
+	if len(manifests) > 0 {
+		// the manifests might hold part of the cluster, so the items of other namespaces are not orphaned
+		r.scoped = true
+		objects, err = readManifests(manifests, cluster)
+	} else {
+		objects, err = r.snapshot(context.Background())
+	}
+	if err != nil {
+		return nil, err
+	}
+	drifts, err := r.diff(objects)
+	if err != nil {
+		return nil, err
+	}
+	report := &DriftReport{Cluster: cluster, Drifts: drifts}
+	for _, d := range drifts {
+		switch d.Type {
+		case DriftMissing:
+			report.Missing++
+		case DriftChanged:
+			report.Changed++
+		case DriftOrphaned:
+			report.Orphaned++
+		}
+	}
+	return report, nil
+}
+
+// writes the drift report as JSON
+func (report *DriftReport) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writes the drift report as text, one line per drifted item followed by its differences
+func (report *DriftReport) writeText(w io.Writer) error {
+	for _, d := range report.Drifts {
+		if _, err := fmt.Fprintf(w, "%-9s %-26s %s\n", d.Type, d.Kind, d.Key); err != nil {
+			return err
+		}
+		for _, diff := range d.Differences {
+			if _, err := fmt.Fprintf(w, "    %s: cmdb=%q cluster=%q\n", diff.Field, diff.CMDB, diff.Cluster); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d drifted items in cluster '%s' (%d missing, %d changed, %d orphaned)\n",
+		len(report.Drifts), report.Cluster, report.Missing, report.Changed, report.Orphaned)
+	return err
+}
+
+// reads the YAML or JSON manifests in the passed-in directory as Sentinel like events by kind of object
+// the kinds without manifests are not compared
+func readManifests(dir string, cluster string) (map[string][][]byte, error) {
+	kube := &Kube{config: KubeConf{Cluster: cluster}}
+	objects := make(map[string][][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			var doc interface{}
+			err = decoder.Decode(&doc)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read manifest %s: %s", path, err)
+			}
+			for _, object := range manifestObjects(jsonValue(doc)) {
+				if err = addManifest(kube, objects, object); err != nil {
+					return fmt.Errorf("failed to read manifest %s: %s", path, err)
+				}
+			}
+		}
+		return nil
+	})
+	return objects, err
+}
+
+// gets the objects in a manifest, expanding lists of objects (e.g. kubectl get -o yaml)
+func manifestObjects(doc interface{}) []map[string]interface{} {
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if kind, _ := object["kind"].(string); strings.HasSuffix(kind, "List") {
+		var objects []map[string]interface{}
+		items, _ := object["items"].([]interface{})
+		for _, item := range items {
+			objects = append(objects, manifestObjects(item)...)
+		}
+		return objects
+	}
+	return []map[string]interface{}{object}
+}
+
+// adds the event for a manifest object to the objects of its kind
+// the objects of kinds not recorded are skipped
+func addManifest(kube *Kube, objects map[string][][]byte, object map[string]interface{}) error {
+	kind, _ := object["kind"].(string)
+	resource, ok := manifestResource(kind)
+	if !ok {
+		return nil
+	}
+	// namespaced objects exported without a namespace are in the default namespace
+	if resource.tag != "ns" && !clusterScoped[resource.tag] {
+		metadata, ok := object["metadata"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s has no metadata", kind)
+		}
+		if namespace, _ := metadata["namespace"].(string); len(namespace) == 0 {
+			metadata["namespace"] = "default"
+		}
+	}
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	event, err := kube.newEvent(resource, "update", raw)
+	if err != nil {
+		return err
+	}
+	objects[resource.kind] = append(objects[resource.kind], event)
+	return nil
+}
+
+var upperCase = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+// gets the resource of the passed-in kind of object (e.g. Deployment)
+func manifestResource(kind string) (kubeResource, bool) {
+	name, ok := manifestKinds[kind]
+	if !ok {
+		name = strings.ToLower(upperCase.ReplaceAllString(kind, "${1}_${2}"))
+	}
+	for _, resource := range kubeResources {
+		if strings.EqualFold(resource.kind, name) {
+			return resource, true
+		}
+	}
+	return kubeResource{}, false
+}
+
+// converts the maps decoded from YAML into maps that can be encoded as JSON
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonValue(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonValue(val)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDriftOfPartialManifestsIgnoresOtherNamespaces(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	// the CMDB holds two namespaces with a config map each, and a config map no longer in the first one
+	for _, ns := range []string{"ns1", "ns2"} {
+		onix.items[nsKey("test", ns)] = Item{Key: nsKey("test", ns), Name: ns, Type: K8SNamespace, Attribute: MAP{"cluster": "test"}}
+	}
+	for _, cm := range []struct{ ns, name string }{{"ns1", "app"}, {"ns1", "old"}, {"ns2", "app"}} {
+		key := nsKey("test", cm.ns) + "-" + ConfigMapNameTag + "-" + cm.name
+		onix.items[key] = Item{Key: key, Name: cm.name, Type: K8SConfigMap, Attribute: MAP{"cluster": "test", "namespace": cm.ns}}
+	}
+
+	// the manifests only hold the config map of the first namespace
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  namespace: ns1\ndata:\n  a: \"1\"\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := readManifests(dir, "test")
+	if err != nil {
+		t.Fatalf("failed to read the manifests: %s", err)
+	}
+	r := &Reconciler{log: ox.Log, config: ReconcileConf{Cluster: "test"}, ox: ox, scoped: true}
+	drifts, err := r.diff(objects)
+	if err != nil {
+		t.Fatalf("failed to compare the manifests: %s", err)
+	}
+	var orphaned []string
+	for _, d := range drifts {
+		if d.Type == DriftOrphaned {
+			orphaned = append(orphaned, d.Key)
+		}
+	}
+	if len(orphaned) != 1 || orphaned[0] != "k8s-test-ns-ns1-cm-old" {
+		t.Errorf("expected only the config map no longer in the first namespace to be orphaned, got %v", orphaned)
+	}
+}
+
+func TestDriftOfManifestsReportsDeletedLabels(t *testing.T) {
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	defer stop()
+
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  namespace: ns1\n%sdata:\n  a: \"1\"\n"
+	path := filepath.Join(dir, "app.yaml")
+	r := &Reconciler{log: ox.Log, config: ReconcileConf{Cluster: "test"}, ox: ox, scoped: true}
+
+	// the CMDB holds the config map recorded from the manifest with a label
+	if err = ioutil.WriteFile(path, []byte(fmt.Sprintf(manifest, "  labels:\n    app: web\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := readManifests(dir, "test")
+	if err != nil {
+		t.Fatalf("failed to read the manifests: %s", err)
+	}
+	resource, _ := manifestResource("ConfigMap")
+	recorded, err := resource.item(objects[resource.kind][0])
+	if err != nil {
+		t.Fatalf("failed to build the recorded item: %s", err)
+	}
+	onix.items[recorded.Key] = *recorded
+	if drifts, err := r.diff(objects); err != nil || len(drifts) > 0 {
+		t.Fatalf("expected no drift from the recorded manifest, got %v %v", drifts, err)
+	}
+
+	// the label is deleted from the manifest
+	if err = ioutil.WriteFile(path, []byte(fmt.Sprintf(manifest, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if objects, err = readManifests(dir, "test"); err != nil {
+		t.Fatalf("failed to read the manifests: %s", err)
+	}
+	drifts, err := r.diff(objects)
+	if err != nil {
+		t.Fatalf("failed to compare the manifests: %s", err)
+	}
+	if len(drifts) != 1 || drifts[0].Type != DriftChanged || len(drifts[0].Differences) != 1 ||
+		drifts[0].Differences[0].Field != "attribute.app" {
+		t.Errorf("expected the deleted label to be reported as drift, got %v", drifts)
+	}
+}
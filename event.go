@@ -26,7 +26,7 @@ type Event struct {
 
 // information about the K8S object status change
 type StatusChange struct {
-	key       string    `json:"key"`
+	Key       string    `json:"key"`
 	Name      string    `json:"name"`
 	Type      string    `json:"type"`
 	Namespace string    `json:"namespace"`
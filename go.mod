@@ -1,13 +1,15 @@
 module gatblau.org/oxkube
 
-go 1.12
+go 1.13
 
 require (
-	github.com/go-logfmt/logfmt v0.4.0 // indirect
+	github.com/Shopify/sarama v1.27.2
 	github.com/prometheus/client_golang v1.0.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/viper v1.4.0
+	github.com/streadway/amqp v1.0.0
 	github.com/tidwall/gjson v1.2.1
 	github.com/tidwall/match v1.0.1 // indirect
 	github.com/tidwall/pretty v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
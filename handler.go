@@ -0,0 +1,181 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Handler records the changes of a kind of K8S object in the CMDB
+type Handler interface {
+	Create(ox *Client, event []byte) (*Result, error)
+	Update(ox *Client, event []byte) (*Result, error)
+	Delete(ox *Client, event []byte) (*Result, error)
+}
+
+// HandlerFunc records a single type of change of a K8S object in the CMDB
+type HandlerFunc func(ox *Client, event []byte) (*Result, error)
+
+// HandlerFuncs adapts ordinary functions to the Handler interface
+// changes without a function are ignored
+type HandlerFuncs struct {
+	CreateFunc HandlerFunc
+	UpdateFunc HandlerFunc
+	DeleteFunc HandlerFunc
+}
+
+func (h HandlerFuncs) Create(ox *Client, event []byte) (*Result, error) {
+	return h.call(h.CreateFunc, ox, event)
+}
+
+func (h HandlerFuncs) Update(ox *Client, event []byte) (*Result, error) {
+	return h.call(h.UpdateFunc, ox, event)
+}
+
+func (h HandlerFuncs) Delete(ox *Client, event []byte) (*Result, error) {
+	return h.call(h.DeleteFunc, ox, event)
+}
+
+func (h HandlerFuncs) call(fx HandlerFunc, ox *Client, event []byte) (*Result, error) {
+	if fx == nil {
+		return nil, nil
+	}
+	return fx(ox, event)
+}
+
+// ItemHandler creates a handler for K8S objects recorded as a single item,
+// which is put on create and update, and deleted using the passed-in key
+func ItemHandler(put HandlerFunc, key func(event []byte) string) Handler {
+	return HandlerFuncs{
+		CreateFunc: put,
+		UpdateFunc: put,
+		DeleteFunc: func(ox *Client, event []byte) (*Result, error) {
+			return ox.removeItem(key(event), event)
+		},
+	}
+}
+
+// ControllerHandler creates a handler for K8S controllers of the specified owner kind,
+// which are put on create and update, and deleted along with the items they own
+// if cascading is enabled
+func ControllerHandler(put HandlerFunc, kind string) Handler {
+	return HandlerFuncs{
+		CreateFunc: put,
+		UpdateFunc: put,
+		DeleteFunc: func(ox *Client, event []byte) (*Result, error) {
+			return ox.deleteController(event, kind)
+		},
+	}
+}
+
+// gets a function returning the item key of a K8S object with the passed-in name tag
+func keyOf(nameTag string) func(event []byte) string {
+	return func(event []byte) string {
+		return itemKey(event, nameTag)
+	}
+}
+
+// Registry holds the handlers for each kind of K8S object
+type Registry struct {
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+// creates a new empty handler registry
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// Register sets the handler for the specified kind of K8S object (i.e. the value of Change.kind)
+// replacing any handler previously registered for the kind
+func (r *Registry) Register(kind string, handler Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers[strings.ToLower(kind)] = handler
+}
+
+// Get returns the handler registered for the specified kind of K8S object
+func (r *Registry) Get(kind string) (Handler, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	handler, ok := r.handlers[strings.ToLower(kind)]
+	return handler, ok
+}
+
+// Kinds returns the kinds of K8S object with a registered handler
+func (r *Registry) Kinds() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// Handlers is the registry shared by all event consumers
+var Handlers = NewRegistry()
+
+// registers the handlers for the K8S objects recorded out of the box
+func init() {
+	Handlers.Register("namespace", HandlerFuncs{
+		CreateFunc: (*Client).putNamespace,
+		UpdateFunc: (*Client).putNamespace,
+		DeleteFunc: (*Client).deleteNamespace,
+	})
+	Handlers.Register("node", ItemHandler((*Client).putNode, keyOf(NodeNameTag)))
+	Handlers.Register("persistent_volume", ItemHandler((*Client).putPersistentVolume, keyOf(PersistentVolumeNameTag)))
+	Handlers.Register("storage_class", ItemHandler((*Client).putStorageClass, keyOf(StorageClassNameTag)))
+	Handlers.Register("pod", HandlerFuncs{
+		CreateFunc: (*Client).putPod,
+		UpdateFunc: (*Client).putPod,
+		DeleteFunc: (*Client).deletePod,
+	})
+	Handlers.Register("service", ItemHandler((*Client).putService, keyOf(ServiceNameTag)))
+	Handlers.Register("persistent_volume_claim", ItemHandler((*Client).putPersistentVolumeClaim, keyOf(PersistentVolumeClaimNameTag)))
+	Handlers.Register("replication_controller", ControllerHandler((*Client).putReplicationController, "ReplicationController"))
+	Handlers.Register("resourcequota", ItemHandler((*Client).putResourceQuota, keyOf(ResourceQuotaNameTag)))
+	Handlers.Register("limit_range", ItemHandler((*Client).putLimitRange, keyOf(LimitRangeNameTag)))
+	Handlers.Register("config_map", ItemHandler((*Client).putConfigMap, keyOf(ConfigMapNameTag)))
+	Handlers.Register("secret", ItemHandler((*Client).putSecret, keyOf(SecretNameTag)))
+	Handlers.Register("service_account", ItemHandler((*Client).putServiceAccount, keyOf(ServiceAccountNameTag)))
+	Handlers.Register("role", ItemHandler((*Client).putRole, keyOf(RoleNameTag)))
+	Handlers.Register("role_binding", ItemHandler((*Client).putRoleBinding, keyOf(RoleBindingNameTag)))
+	Handlers.Register("cluster_role", ItemHandler((*Client).putClusterRole, keyOf(ClusterRoleNameTag)))
+	Handlers.Register("cluster_role_binding", ItemHandler((*Client).putClusterRoleBinding, keyOf(ClusterRoleBindingNameTag)))
+	Handlers.Register("network_policy", ItemHandler((*Client).putNetworkPolicy, keyOf(NetworkPolicyNameTag)))
+	Handlers.Register("horizontal_pod_autoscaler", ItemHandler((*Client).putHorizontalPodAutoscaler, keyOf(AutoscalerNameTag)))
+	Handlers.Register("pod_disruption_budget", ItemHandler((*Client).putPodDisruptionBudget, keyOf(PodDisruptionBudgetNameTag)))
+	Handlers.Register("endpoints", HandlerFuncs{
+		CreateFunc: (*Client).putEndpoints,
+		UpdateFunc: (*Client).putEndpoints,
+		DeleteFunc: (*Client).deleteEndpoints,
+	})
+	Handlers.Register("endpoint_slice", HandlerFuncs{
+		CreateFunc: (*Client).putEndpointSlice,
+		UpdateFunc: (*Client).putEndpointSlice,
+		DeleteFunc: (*Client).deleteEndpointSlice,
+	})
+	Handlers.Register("ingress", ItemHandler((*Client).putIngress, keyOf(IngressNameTag)))
+	Handlers.Register("route", ItemHandler((*Client).putRoute, keyOf(RouteNameTag)))
+	Handlers.Register("deployment", ControllerHandler((*Client).putDeployment, "Deployment"))
+	Handlers.Register("replica_set", ControllerHandler((*Client).putReplicaSet, "ReplicaSet"))
+	Handlers.Register("stateful_set", ControllerHandler((*Client).putStatefulSet, "StatefulSet"))
+	Handlers.Register("daemon_set", ControllerHandler((*Client).putDaemonSet, "DaemonSet"))
+	Handlers.Register("cron_job", ControllerHandler((*Client).putCronJob, "CronJob"))
+	Handlers.Register("job", ControllerHandler((*Client).putJob, "Job"))
+}
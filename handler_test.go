@@ -0,0 +1,178 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// a fake Onix WAPI recording the paths of the DELETE requests
+type deleteRecorder struct {
+	lock  sync.Mutex
+	paths []string
+}
+
+func (o *deleteRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if r.Method == DELETE {
+		o.paths = append(o.paths, r.URL.Path)
+	}
+	_, _ = w.Write([]byte(`{"changed":true,"operation":"D"}`))
+}
+
+// a handler recording the changes it is called for
+type recordingHandler struct {
+	name string
+	log  *[]string
+}
+
+func (h recordingHandler) Create(ox *Client, event []byte) (*Result, error) {
+	*h.log = append(*h.log, h.name+":create")
+	return &Result{}, nil
+}
+
+func (h recordingHandler) Update(ox *Client, event []byte) (*Result, error) {
+	*h.log = append(*h.log, h.name+":update")
+	return &Result{}, nil
+}
+
+func (h recordingHandler) Delete(ox *Client, event []byte) (*Result, error) {
+	*h.log = append(*h.log, h.name+":delete")
+	return &Result{}, nil
+}
+
+// creates an event for a change of a K8S object in the "test" cluster
+func changeEvent(kind string, changeType string, namespace string, name string) []byte {
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"%s","type":"%s","name":"%s","namespace":"%s","host":"test"},"Object":{"metadata":{},"spec":{}}}`,
+		kind, changeType, name, namespace))
+}
+
+func TestRegistryKindsAreCaseInsensitive(t *testing.T) {
+	cases := []struct {
+		registered string
+		requested  string
+	}{
+		{"pod", "pod"},
+		{"pod", "POD"},
+		{"Stateful_Set", "stateful_set"},
+		{"kafka", "Kafka"},
+	}
+	for _, c := range cases {
+		var log []string
+		registry := NewRegistry()
+		registry.Register(c.registered, recordingHandler{name: c.registered, log: &log})
+		handler, ok := registry.Get(c.requested)
+		if !ok {
+			t.Errorf("kind '%s' registered as '%s' not found", c.requested, c.registered)
+			continue
+		}
+		_, _ = handler.Create(nil, nil)
+		if len(log) != 1 || log[0] != c.registered+":create" {
+			t.Errorf("kind '%s' got the wrong handler: %v", c.requested, log)
+		}
+	}
+	if _, ok := NewRegistry().Get("pod"); ok {
+		t.Errorf("an empty registry returned a handler")
+	}
+}
+
+func TestRegistryRegisterReplacesHandler(t *testing.T) {
+	var log []string
+	registry := NewRegistry()
+	registry.Register("pod", recordingHandler{name: "first", log: &log})
+	registry.Register("POD", recordingHandler{name: "second", log: &log})
+	handler, _ := registry.Get("pod")
+	_, _ = handler.Delete(nil, nil)
+	if len(log) != 1 || log[0] != "second:delete" {
+		t.Errorf("expected the replacing handler to be called, got %v", log)
+	}
+	if kinds := registry.Kinds(); len(kinds) != 1 {
+		t.Errorf("expected a single kind, got %v", kinds)
+	}
+}
+
+func TestHandlerFuncsWithoutFuncIgnoreChanges(t *testing.T) {
+	var log []string
+	record := func(name string) HandlerFunc {
+		return func(ox *Client, event []byte) (*Result, error) {
+			log = append(log, name)
+			return &Result{}, nil
+		}
+	}
+	cases := []struct {
+		handler  HandlerFuncs
+		expected []string
+	}{
+		{HandlerFuncs{}, nil},
+		{HandlerFuncs{CreateFunc: record("create")}, []string{"create"}},
+		{HandlerFuncs{UpdateFunc: record("update")}, []string{"update"}},
+		{HandlerFuncs{DeleteFunc: record("delete")}, []string{"delete"}},
+	}
+	for i, c := range cases {
+		log = nil
+		changes := map[string]HandlerFunc{"create": c.handler.Create, "update": c.handler.Update, "delete": c.handler.Delete}
+		for name, change := range changes {
+			result, err := change(nil, nil)
+			if err != nil {
+				t.Errorf("case %d: %s failed: %s", i, name, err)
+			}
+			// a change without a function is ignored returning no result
+			if called := contains(log, name); called == (result == nil) {
+				t.Errorf("case %d: %s returned %v", i, name, result)
+			}
+		}
+		if fmt.Sprint(log) != fmt.Sprint(c.expected) {
+			t.Errorf("case %d: expected %v to be called, got %v", i, c.expected, log)
+		}
+	}
+}
+
+func TestHandlerDeleteKeys(t *testing.T) {
+	cases := []struct {
+		handler Handler
+		event   []byte
+		path    string
+	}{
+		{ItemHandler(nil, keyOf(ServiceNameTag)), changeEvent("service", "delete", "ns1", "web"), "/item/k8s-test-ns-ns1-svc-web"},
+		{ItemHandler(nil, keyOf(NodeNameTag)), changeEvent("node", "delete", "", "node1"), "/item/k8s-test-node-node1"},
+		{ItemHandler(nil, NS), changeEvent("namespace", "delete", "", "ns1"), "/item/k8s-test-ns-ns1"},
+		{ControllerHandler(nil, "Deployment"), changeEvent("deployment", "delete", "ns1", "web"), "/item/k8s-test-ns-ns1-deploy-web"},
+		{ControllerHandler(nil, "ReplicaSet"), changeEvent("replica_set", "delete", "ns1", "web-1"), "/item/k8s-test-ns-ns1-rs-web-1"},
+		{ControllerHandler(nil, "CronJob"), changeEvent("cron_job", "delete", "ns1", "backup"), "/item/k8s-test-ns-ns1-cj-backup"},
+	}
+	for _, c := range cases {
+		onix := &deleteRecorder{}
+		srv := httptest.NewServer(onix)
+		log := logrus.NewEntry(logrus.New())
+		ox := &Client{Log: log, Config: &Config{Onix: Onix{URL: srv.URL}}}
+		result, err := c.handler.Delete(ox, c.event)
+		srv.Close()
+		if check(result, err) {
+			t.Errorf("%s: delete failed: %v %v", c.path, result, err)
+			continue
+		}
+		if len(onix.paths) != 1 || onix.paths[0] != c.path {
+			t.Errorf("expected DELETE %s, got %v", c.path, onix.paths)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+type Kafka struct {
+	log    *logrus.Entry
+	config KafkaConf
+	ox     *Client
+	// the interval to wait before retrying an event the CMDB failed to record
+	interval time.Duration
+}
+
+// launch a consumer group member reading events from a Kafka topic
+func (c *Kafka) Start(client *Client) {
+	// set the ox client
+	c.ox = client
+
+	// gets a context cancelled when the consumer has to stop
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// creates a channel to pass a SIGINT (ctrl+C) kernel signal with buffer capacity 1
+	stop := make(chan os.Signal, 1)
+
+	// sends any SIGINT signal to the stop channel
+	signal.Notify(stop, os.Interrupt)
+
+	// waits for the SIGINT signal to be raised (pkill -2) and stops the consumer
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	if err := c.consume(ctx); err != nil {
+		c.log.Fatal(err)
+	}
+	c.log.Println("Shutting down Kafka consumer.")
+}
+
+// joins the consumer group and consumes events until the context is cancelled
+func (c *Kafka) consume(ctx context.Context) error {
+	if c.interval == 0 {
+		c.interval = 30 * time.Second
+	}
+	cfg, err := c.newSaramaConfig()
+	if err != nil {
+		return err
+	}
+	group, err := sarama.NewConsumerGroup(strings.Split(c.config.Brokers, ","), c.config.GroupId, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := group.Close(); err != nil {
+			c.log.Error(err)
+		}
+	}()
+
+	// logs any consumer group errors
+	go func() {
+		for err := range group.Errors() {
+			c.log.Errorf("Kafka consumer error: %s", err)
+		}
+	}()
+
+	c.log.Println(fmt.Sprintf("OxKube consuming from topic '%s' as group '%s'", c.config.Topic, c.config.GroupId))
+	for {
+		// a new session is created after every rebalance, so Consume is called in a loop
+		if err := group.Consume(ctx, []string{c.config.Topic}, c); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Setup is run at the beginning of a new consumer group session
+func (c *Kafka) Setup(session sarama.ConsumerGroupSession) error {
+	c.log.Tracef("Kafka session %d started with claims %v.", session.GenerationID(), session.Claims())
+	return nil
+}
+
+// Cleanup is run at the end of a consumer group session
+func (c *Kafka) Cleanup(session sarama.ConsumerGroupSession) error {
+	c.log.Tracef("Kafka session %d ended.", session.GenerationID())
+	return nil
+}
+
+// ConsumeClaim processes the messages of a topic partition in order
+// the offset of a message is only committed after the CMDB has been updated
+func (c *Kafka) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if !c.handle(session.Context(), msg) {
+			// the session ended before the event could be recorded,
+			// it will be consumed again from the last committed offset
+			return nil
+		}
+		session.MarkMessage(msg, "")
+		session.Commit()
+	}
+	return nil
+}
+
+// processes a single message retrying until it succeeds
+// returns false if the context is done before the message was processed
+func (c *Kafka) handle(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	c.log.Tracef("event: %s", describe(msg.Value))
+
+	// a malformed event will never be processed so it is skipped
+	if !gjson.ValidBytes(msg.Value) {
+		c.log.Errorf("Discarding invalid event at offset %d of partition %d.", msg.Offset, msg.Partition)
+		return true
+	}
+	for {
+		result, err := c.ox.process(msg.Value)
+		if !check(result, err) {
+			return true
+		}
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		} else {
+			errMsg = result.Message
+		}
+		c.log.Errorf("Error whilst processing event at offset %d of partition %d, retrying: %s", msg.Offset, msg.Partition, errMsg)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// creates the sarama configuration for the consumer group
+func (c *Kafka) newSaramaConfig() (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "oxkube"
+	cfg.Consumer.Return.Errors = true
+	// offsets are committed explicitly once the CMDB has been updated
+	cfg.Consumer.Offsets.AutoCommit.Enable = false
+	if len(c.config.Version) > 0 {
+		version, err := sarama.ParseKafkaVersion(c.config.Version)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Version = version
+	}
+	switch strings.ToLower(c.config.InitialOffset) {
+	case "newest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "", "oldest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, fmt.Errorf("initial offset '%s' is not valid, use either oldest or newest", c.config.InitialOffset)
+	}
+	if c.config.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(c.config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,181 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testTopic = "sentinel"
+	testGroup = "oxkube"
+)
+
+// a fake Onix WAPI failing the first n PUT requests
+type fakeOnix struct {
+	lock     sync.Mutex
+	failures int
+	puts     int
+}
+
+func (o *fakeOnix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.puts++
+	if o.puts <= o.failures {
+		_, _ = w.Write([]byte(`{"error":true,"message":"CMDB unavailable"}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"changed":true,"operation":"I"}`))
+}
+
+func (o *fakeOnix) count() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.puts
+}
+
+// creates a namespace event as published by Sentinel
+func nsEvent(name string) sarama.StringEncoder {
+	return sarama.StringEncoder(fmt.Sprintf(
+		`{"Change":{"kind":"namespace","type":"create","name":"%s","host":"test"},"Object":{"metadata":{},"spec":{}}}`, name))
+}
+
+// launches an in-process fake kafka broker with a single partition topic holding the passed-in events
+func newFakeKafka(t *testing.T, events ...sarama.Encoder) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 0)
+	fetch := sarama.NewMockFetchResponse(t, 1).SetVersion(3)
+	for offset, event := range events {
+		fetch.SetMessage(testTopic, 0, int64(offset), event)
+	}
+	fetch.SetHighWaterMark(testTopic, 0, int64(len(events)))
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(testTopic, 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, testGroup, broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.BalanceStrategyRange.Name()).
+			SetMemberId("m1").
+			SetLeaderId("m1").
+			SetMember("m1", &sarama.ConsumerGroupMemberMetadata{Topics: []string{testTopic}}),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).
+			SetMemberAssignment(&sarama.ConsumerGroupMemberAssignment{
+				Topics: map[string][]int32{testTopic: {0}},
+			}),
+		"HeartbeatRequest":  sarama.NewMockHeartbeatResponse(t),
+		"LeaveGroupRequest": sarama.NewMockLeaveGroupResponse(t),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(testGroup, testTopic, 0, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetVersion(1).
+			SetOffset(testTopic, 0, sarama.OffsetOldest, 0).
+			SetOffset(testTopic, 0, sarama.OffsetNewest, int64(len(events))),
+		"FetchRequest":        fetch,
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+	return broker
+}
+
+// gets the offsets committed for the test partition in the order they were received by the broker
+func committedOffsets(broker *sarama.MockBroker) []int64 {
+	var offsets []int64
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			if offset, _, err := req.Offset(testTopic, 0); err == nil {
+				offsets = append(offsets, offset)
+			}
+		}
+	}
+	return offsets
+}
+
+// starts a kafka consumer against the fake broker and CMDB until the condition is met or times out
+func runKafka(t *testing.T, broker *sarama.MockBroker, onix *fakeOnix, until func() bool) {
+	srv := httptest.NewServer(onix)
+	defer srv.Close()
+
+	log := logrus.NewEntry(logrus.New())
+	consumer := &Kafka{
+		log: log,
+		config: KafkaConf{
+			Brokers: broker.Addr(),
+			Topic:   testTopic,
+			GroupId: testGroup,
+			Version: "0.10.2.0",
+		},
+		ox:       &Client{Log: log, Config: &Config{Onix: Onix{URL: srv.URL}}},
+		interval: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.consume(ctx)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for !until() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consumer failed: %s", err)
+	}
+}
+
+func TestKafkaCommitsOffsetsAfterCMDBWrites(t *testing.T) {
+	broker := newFakeKafka(t, nsEvent("ns1"), nsEvent("ns2"))
+	defer broker.Close()
+	// the first write to the CMDB fails so the first event has to be retried
+	onix := &fakeOnix{failures: 1}
+
+	runKafka(t, broker, onix, func() bool {
+		offsets := committedOffsets(broker)
+		return len(offsets) > 0 && offsets[len(offsets)-1] == 2
+	})
+
+	// each namespace event requires three writes (cluster, namespace and link) plus the failed one
+	if onix.count() != 7 {
+		t.Errorf("expected 7 CMDB writes, got %d", onix.count())
+	}
+	offsets := committedOffsets(broker)
+	if len(offsets) != 2 || offsets[0] != 1 || offsets[1] != 2 {
+		t.Errorf("expected offsets 1 and 2 to be committed in order, got %v", offsets)
+	}
+}
+
+func TestKafkaDoesNotCommitOffsetsOnCMDBError(t *testing.T) {
+	broker := newFakeKafka(t, nsEvent("ns1"))
+	defer broker.Close()
+	// the CMDB never accepts the event
+	onix := &fakeOnix{failures: 1 << 30}
+
+	runKafka(t, broker, onix, func() bool {
+		return onix.count() >= 5
+	})
+
+	if offsets := committedOffsets(broker); len(offsets) > 0 {
+		t.Errorf("expected no offsets to be committed, got %v", offsets)
+	}
+}
@@ -0,0 +1,264 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// a K8S resource watched by the kube consumer
+type kubeResource struct {
+	// the kind of object as set in Change.kind
+	kind string
+	// the API server path used to list and watch all objects of the kind
+	path string
+	// the type and name tag of the items recorded for the objects of the kind
+	itemType K8SOBJ
+	tag      string
+}
+
+// the K8S resources watched by the kube consumer
+var kubeResources = []kubeResource{
+	{kind: "namespace", path: "/api/v1/namespaces", itemType: K8SNamespace, tag: "ns"},
+	{kind: "node", path: "/api/v1/nodes", itemType: K8SNode, tag: NodeNameTag},
+	{kind: "persistent_volume", path: "/api/v1/persistentvolumes", itemType: K8SPersistentVolume, tag: PersistentVolumeNameTag},
+	{kind: "storage_class", path: "/apis/storage.k8s.io/v1/storageclasses", itemType: K8SStorageClass, tag: StorageClassNameTag},
+	{kind: "pod", path: "/api/v1/pods", itemType: K8SPod, tag: PodNameTag},
+	{kind: "service", path: "/api/v1/services", itemType: K8SService, tag: ServiceNameTag},
+	// endpoint slices supersede endpoints so only the former are watched
+	{kind: "endpoint_slice", path: "/apis/discovery.k8s.io/v1/endpointslices", itemType: K8SEndpoints, tag: EndpointSliceNameTag},
+	{kind: "persistent_volume_claim", path: "/api/v1/persistentvolumeclaims", itemType: K8SPersistentVolumeClaim, tag: PersistentVolumeClaimNameTag},
+	{kind: "replication_controller", path: "/api/v1/replicationcontrollers", itemType: K8SReplicationController, tag: ReplicationControllerNameTag},
+	{kind: "resourcequota", path: "/api/v1/resourcequotas", itemType: K8SResourceQuota, tag: ResourceQuotaNameTag},
+	{kind: "limit_range", path: "/api/v1/limitranges", itemType: K8SLimitRange, tag: LimitRangeNameTag},
+	{kind: "config_map", path: "/api/v1/configmaps", itemType: K8SConfigMap, tag: ConfigMapNameTag},
+	{kind: "secret", path: "/api/v1/secrets", itemType: K8SSecret, tag: SecretNameTag},
+	{kind: "service_account", path: "/api/v1/serviceaccounts", itemType: K8SServiceAccount, tag: ServiceAccountNameTag},
+	{kind: "role", path: "/apis/rbac.authorization.k8s.io/v1/roles", itemType: K8SRole, tag: RoleNameTag},
+	{kind: "role_binding", path: "/apis/rbac.authorization.k8s.io/v1/rolebindings", itemType: K8SRoleBinding, tag: RoleBindingNameTag},
+	{kind: "cluster_role", path: "/apis/rbac.authorization.k8s.io/v1/clusterroles", itemType: K8SClusterRole, tag: ClusterRoleNameTag},
+	{kind: "cluster_role_binding", path: "/apis/rbac.authorization.k8s.io/v1/clusterrolebindings", itemType: K8SClusterRoleBinding, tag: ClusterRoleBindingNameTag},
+	{kind: "network_policy", path: "/apis/networking.k8s.io/v1/networkpolicies", itemType: K8SNetworkPolicy, tag: NetworkPolicyNameTag},
+	{kind: "horizontal_pod_autoscaler", path: "/apis/autoscaling/v2/horizontalpodautoscalers", itemType: K8SAutoscaler, tag: AutoscalerNameTag},
+	{kind: "pod_disruption_budget", path: "/apis/policy/v1/poddisruptionbudgets", itemType: K8SPodDisruptionBudget, tag: PodDisruptionBudgetNameTag},
+	{kind: "ingress", path: "/apis/networking.k8s.io/v1/ingresses", itemType: K8SIngress, tag: IngressNameTag},
+	{kind: "route", path: "/apis/route.openshift.io/v1/routes", itemType: K8SIngress, tag: RouteNameTag},
+	{kind: "deployment", path: "/apis/apps/v1/deployments", itemType: K8SDeployment, tag: DeploymentNameTag},
+	{kind: "replica_set", path: "/apis/apps/v1/replicasets", itemType: K8SReplicaSet, tag: ReplicaSetNameTag},
+	{kind: "stateful_set", path: "/apis/apps/v1/statefulsets", itemType: K8SStatefulSet, tag: StatefulSetNameTag},
+	{kind: "daemon_set", path: "/apis/apps/v1/daemonsets", itemType: K8SDaemonSet, tag: DaemonSetNameTag},
+	{kind: "cron_job", path: "/apis/batch/v1/cronjobs", itemType: K8SCronJob, tag: CronJobNameTag},
+	{kind: "job", path: "/apis/batch/v1/jobs", itemType: K8SJob, tag: JobNameTag},
+}
+
+// the watch event types mapped to the Sentinel change types
+var kubeChangeTypes = map[string]string{
+	"ADDED":    "create",
+	"MODIFIED": "update",
+	"DELETED":  "delete",
+}
+
+type Kube struct {
+	log    *logrus.Entry
+	config KubeConf
+	ox     *Client
+	api    *KubeAPI
+	// the interval to wait before watching a resource again after a failure
+	interval time.Duration
+}
+
+// launch a consumer watching K8S resources directly from the API server
+func (c *Kube) Start(client *Client) {
+	// set the ox client
+	c.ox = client
+
+	// gets a context cancelled when the consumer has to stop
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// creates a channel to pass a SIGINT (ctrl+C) kernel signal with buffer capacity 1
+	stop := make(chan os.Signal, 1)
+
+	// sends any SIGINT signal to the stop channel
+	signal.Notify(stop, os.Interrupt)
+
+	// waits for the SIGINT signal to be raised (pkill -2) and stops the consumer
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	if err := c.consume(ctx); err != nil {
+		c.log.Fatal(err)
+	}
+	c.log.Println("Shutting down Kube consumer.")
+}
+
+// watches all the K8S resources until the context is cancelled
+func (c *Kube) consume(ctx context.Context) error {
+	if c.interval == 0 {
+		c.interval = 30 * time.Second
+	}
+	if c.api == nil {
+		api, err := NewKubeAPI(c.config.Kubeconfig)
+		if err != nil {
+			return err
+		}
+		c.api = api
+	}
+	c.log.Println(fmt.Sprintf("OxKube watching cluster '%s' at %s", c.config.Cluster, c.api.Host))
+	var wg sync.WaitGroup
+	for _, resource := range kubeResources {
+		wg.Add(1)
+		go func(resource kubeResource) {
+			defer wg.Done()
+			c.watch(ctx, resource)
+		}(resource)
+	}
+	wg.Wait()
+	return nil
+}
+
+// lists and then watches a K8S resource, resuming from the last resource version seen
+// if the watch is closed, and listing again if the resource version has expired
+func (c *Kube) watch(ctx context.Context, resource kubeResource) {
+	var (
+		resourceVersion string
+		err             error
+	)
+	for ctx.Err() == nil {
+		if len(resourceVersion) == 0 {
+			resourceVersion, err = c.list(ctx, resource)
+		} else {
+			resourceVersion, err = c.api.watch(ctx, resource.path, resourceVersion, func(event kubeWatchEvent) error {
+				return c.handle(resource, kubeChangeTypes[event.Type], event.Object)
+			})
+		}
+		if err == errResourceExpired {
+			c.log.Tracef("Resource version for %s has expired, listing again.", resource.kind)
+			resourceVersion = ""
+			continue
+		}
+		if err == errResourceNotFound {
+			c.log.Tracef("Resource %s is not served by the cluster, it will not be watched.", resource.kind)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			c.log.Warnf("Watch of %s failed: %s. Waiting before attempting to watch again.", resource.kind, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.interval):
+			}
+		}
+	}
+}
+
+// lists all the objects of a resource recording them in the CMDB
+// returns the resource version to start watching from
+func (c *Kube) list(ctx context.Context, resource kubeResource) (string, error) {
+	list, err := c.api.list(ctx, resource.path)
+	if err != nil {
+		return "", err
+	}
+	for _, object := range list.Items {
+		if err = c.handle(resource, "create", object); err != nil {
+			return "", err
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// converts the K8S object into a Sentinel like event and records it in the CMDB
+func (c *Kube) handle(resource kubeResource, changeType string, object json.RawMessage) error {
+	event, err := c.newEvent(resource, changeType, object)
+	if err != nil {
+		return err
+	}
+	c.log.Tracef("event: %s", describe(event))
+	result, err := c.ox.process(event)
+	if check(result, err) {
+		if err == nil {
+			err = fmt.Errorf("failed to record %s change: %s", resource.kind, result.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// creates the event that Sentinel would have published for the change
+func (c *Kube) newEvent(resource kubeResource, changeType string, object json.RawMessage) ([]byte, error) {
+	meta := struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(object, &meta); err != nil {
+		return nil, err
+	}
+	key := meta.Metadata.Name
+	if len(meta.Metadata.Namespace) > 0 {
+		key = fmt.Sprintf("%s/%s", meta.Metadata.Namespace, meta.Metadata.Name)
+	}
+	// the handlers only need the names of the keys of a secret
+	if resource.kind == "secret" {
+		var err error
+		if object, err = redactSecret(object); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(Event{
+		Change: StatusChange{
+			Key:       key,
+			Name:      meta.Metadata.Name,
+			Type:      changeType,
+			Namespace: meta.Metadata.Namespace,
+			Kind:      resource.kind,
+			Time:      time.Now(),
+			Host:      c.config.Cluster,
+		},
+		Object: object,
+	})
+}
+
+// removes the values of the passed-in secret object keeping the names of its keys,
+// and the last applied configuration annotation holding the values too
+func redactSecret(object json.RawMessage) (json.RawMessage, error) {
+	secret := make(map[string]interface{})
+	if err := json.Unmarshal(object, &secret); err != nil {
+		return nil, err
+	}
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := secret[field].(map[string]interface{}); ok {
+			for key := range data {
+				data[key] = ""
+			}
+		}
+	}
+	if metadata, ok := secret["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		}
+	}
+	return json.Marshal(secret)
+}
@@ -0,0 +1,269 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a fake K8S API server calling the serve function with the number of requests received before each one
+type fakeKube struct {
+	lock     sync.Mutex
+	requests []url.Values
+	serve    func(w http.ResponseWriter, query url.Values, n int)
+}
+
+func (k *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.lock.Lock()
+	n := len(k.requests)
+	k.requests = append(k.requests, r.URL.Query())
+	k.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	k.serve(w, r.URL.Query(), n)
+}
+
+// gets the queries of the requests received
+func (k *fakeKube) queries() []url.Values {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return append([]url.Values{}, k.requests...)
+}
+
+// a namespace object at the passed-in resource version
+func nsObject(name string, resourceVersion string) string {
+	return fmt.Sprintf(`{"metadata":{"name":"%s","resourceVersion":"%s"}}`, name, resourceVersion)
+}
+
+// a list of objects as returned by the API server
+func writeList(w http.ResponseWriter, resourceVersion string, next string, objects ...string) {
+	list := fmt.Sprintf(`{"metadata":{"resourceVersion":"%s","continue":"%s"},"items":[`, resourceVersion, next)
+	for i, object := range objects {
+		if i > 0 {
+			list += ","
+		}
+		list += object
+	}
+	_, _ = w.Write([]byte(list + "]}"))
+}
+
+// a watch event as streamed by the API server
+func writeEvent(w http.ResponseWriter, eventType string, object string) {
+	_, _ = w.Write([]byte(fmt.Sprintf(`{"type":"%s","object":%s}`+"\n", eventType, object)))
+}
+
+// starts a kube consumer against the fake API server recording in an in-memory CMDB
+func newTestKube(kube *fakeKube) (*Kube, *memOnix, func()) {
+	srv := httptest.NewServer(kube)
+	onix := newMemOnix()
+	ox, stop := onix.start()
+	consumer := &Kube{
+		log:      ox.Log,
+		config:   KubeConf{Cluster: "test"},
+		ox:       ox,
+		api:      &KubeAPI{Host: srv.URL, client: srv.Client()},
+		interval: 10 * time.Millisecond,
+	}
+	return consumer, onix, func() {
+		stop()
+		srv.Close()
+	}
+}
+
+// watches the resource until the context is cancelled by the fake API server or times out
+func runWatch(t *testing.T, consumer *Kube, ctx context.Context, resource kubeResource) {
+	done := make(chan bool)
+	go func() {
+		consumer.watch(ctx, resource)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the watch of %s did not stop", resource.kind)
+	}
+}
+
+func TestKubeAPIListsAllPages(t *testing.T) {
+	kube := &fakeKube{serve: func(w http.ResponseWriter, query url.Values, n int) {
+		if len(query.Get("continue")) == 0 {
+			writeList(w, "10", "page2", nsObject("ns1", "8"), nsObject("ns2", "9"))
+			return
+		}
+		// the resource version of the following pages is not the one of the list
+		writeList(w, "", "", nsObject("ns3", "10"))
+	}}
+	srv := httptest.NewServer(kube)
+	defer srv.Close()
+	api := &KubeAPI{Host: srv.URL, client: srv.Client()}
+
+	list, err := api.list(context.Background(), "/api/v1/namespaces")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(list.Items) != 3 || list.Metadata.ResourceVersion != "10" {
+		t.Errorf("expected the 3 objects of both pages at resource version 10, got %d at %s", len(list.Items), list.Metadata.ResourceVersion)
+	}
+	queries := kube.queries()
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 page requests, got %d", len(queries))
+	}
+	for i, query := range queries {
+		if query.Get("limit") != fmt.Sprint(kubeListLimit) {
+			t.Errorf("expected page %d to be limited to %d objects, got %s", i+1, kubeListLimit, query.Get("limit"))
+		}
+	}
+	if queries[1].Get("continue") != "page2" {
+		t.Errorf("expected the second page to continue from the first, got '%s'", queries[1].Get("continue"))
+	}
+}
+
+func TestKubeWatchResumesFromTheLastResourceVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kube := &fakeKube{serve: func(w http.ResponseWriter, query url.Values, n int) {
+		switch n {
+		case 0:
+			writeList(w, "10", "", nsObject("ns1", "10"))
+		case 1:
+			// the stream is closed by the server after an event and a bookmark
+			writeEvent(w, "ADDED", nsObject("ns2", "11"))
+			writeEvent(w, "BOOKMARK", `{"metadata":{"resourceVersion":"12"}}`)
+		default:
+			cancel()
+		}
+	}}
+	consumer, onix, stop := newTestKube(kube)
+	defer stop()
+
+	runWatch(t, consumer, ctx, kubeResources[0])
+
+	queries := kube.queries()
+	if len(queries) != 3 {
+		t.Fatalf("expected a list and two watches, got %d requests", len(queries))
+	}
+	if queries[1].Get("watch") != "true" || queries[1].Get("resourceVersion") != "10" {
+		t.Errorf("expected the watch to start from the list resource version 10, got %v", queries[1])
+	}
+	if queries[2].Get("watch") != "true" || queries[2].Get("resourceVersion") != "12" {
+		t.Errorf("expected the watch to resume from the bookmark resource version 12, got %v", queries[2])
+	}
+	for _, ns := range []string{"ns1", "ns2"} {
+		if _, ok := onix.items[nsKey("test", ns)]; !ok {
+			t.Errorf("expected namespace %s to be recorded", ns)
+		}
+	}
+}
+
+func TestKubeWatchListsAgainWhenTheResourceVersionExpires(t *testing.T) {
+	cases := []struct {
+		name    string
+		expired func(w http.ResponseWriter)
+	}{
+		{"status", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusGone)
+		}},
+		{"event", func(w http.ResponseWriter) {
+			status, _ := json.Marshal(kubeStatus{Code: http.StatusGone, Reason: "Expired", Message: "too old resource version"})
+			writeEvent(w, "ERROR", string(status))
+		}},
+	}
+	for _, c := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		kube := &fakeKube{serve: func(w http.ResponseWriter, query url.Values, n int) {
+			switch n {
+			case 0:
+				writeList(w, "10", "", nsObject("ns1", "10"))
+			case 1:
+				c.expired(w)
+			case 2:
+				writeList(w, "20", "", nsObject("ns1", "10"), nsObject("ns2", "20"))
+			default:
+				cancel()
+			}
+		}}
+		consumer, onix, stop := newTestKube(kube)
+		runWatch(t, consumer, ctx, kubeResources[0])
+		stop()
+		cancel()
+
+		queries := kube.queries()
+		if len(queries) != 4 || len(queries[2].Get("watch")) > 0 {
+			t.Errorf("%s: expected the resource to be listed again after the watch expired, got %v", c.name, queries)
+			continue
+		}
+		if queries[3].Get("resourceVersion") != "20" {
+			t.Errorf("%s: expected the watch to start from the new list resource version 20, got %v", c.name, queries[3])
+		}
+		if _, ok := onix.items[nsKey("test", "ns2")]; !ok {
+			t.Errorf("%s: expected the namespace listed again to be recorded", c.name)
+		}
+	}
+}
+
+func TestKubeDoesNotWatchResourcesNotServed(t *testing.T) {
+	kube := &fakeKube{serve: func(w http.ResponseWriter, query url.Values, n int) {
+		w.WriteHeader(http.StatusNotFound)
+	}}
+	consumer, _, stop := newTestKube(kube)
+	defer stop()
+
+	// the watch stops on its own as the context is never cancelled
+	runWatch(t, consumer, context.Background(), kubeResource{kind: "route", path: "/apis/route.openshift.io/v1/routes", itemType: K8SIngress, tag: RouteNameTag})
+
+	if n := len(kube.queries()); n != 1 {
+		t.Errorf("expected a single list request for a resource not served, got %d", n)
+	}
+}
+
+func TestRedactSecretKeepsTheNamesOfTheKeysOnly(t *testing.T) {
+	secret := `{"metadata":{"name":"creds","annotations":{"owner":"team","kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"c2VjcmV0\"}}"}},
+		"type":"Opaque","data":{"password":"c2VjcmV0"},"stringData":{"user":"admin"}}`
+	redacted, err := redactSecret(json.RawMessage(secret))
+	if err != nil {
+		t.Fatalf("failed to redact the secret: %s", err)
+	}
+	object := struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Type       string            `json:"type"`
+		Data       map[string]string `json:"data"`
+		StringData map[string]string `json:"stringData"`
+	}{}
+	if err = json.Unmarshal(redacted, &object); err != nil {
+		t.Fatalf("failed to read the redacted secret: %s", err)
+	}
+	if value, ok := object.Data["password"]; !ok || len(value) > 0 {
+		t.Errorf("expected the data key to be kept without its value, got %v", object.Data)
+	}
+	if value, ok := object.StringData["user"]; !ok || len(value) > 0 {
+		t.Errorf("expected the string data key to be kept without its value, got %v", object.StringData)
+	}
+	if _, ok := object.Metadata.Annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		t.Errorf("expected the last applied configuration to be removed")
+	}
+	if object.Metadata.Annotations["owner"] != "team" || object.Type != "Opaque" {
+		t.Errorf("expected the other fields to be kept, got %s", redacted)
+	}
+}
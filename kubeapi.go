@@ -0,0 +1,344 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the location of the service account credentials mounted in a pod
+	ServiceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	ServiceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// a minimal Kubernetes API server REST client able to list and watch resources
+type KubeAPI struct {
+	Host   string
+	Token  string
+	client *http.Client
+}
+
+// a list of K8S objects as returned by the API server
+type kubeList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+		// the token to get the next page of the list, empty if it is the last page
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// a watch event as streamed by the API server
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// the status returned by the API server when a watch fails
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// the maximum number of objects requested per page when listing resources
+const kubeListLimit = 500
+
+var (
+	// the error returned when the requested resource version is too old to watch from
+	errResourceExpired = errors.New("resource version expired")
+	// the error returned when the resource is not served by the API server (e.g. OpenShift routes in Kubernetes)
+	errResourceNotFound = errors.New("resource not found")
+)
+
+// creates a new API server client using the passed-in kubeconfig file
+// or the pod service account if no kubeconfig file is specified
+func NewKubeAPI(kubeconfig string) (*KubeAPI, error) {
+	if len(kubeconfig) > 0 {
+		return newKubeAPIFromConfig(kubeconfig)
+	}
+	return newKubeAPIInCluster()
+}
+
+// creates a client using the service account of the pod the agent runs in
+func newKubeAPIInCluster() (*KubeAPI, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, errors.New("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not defined")
+	}
+	token, err := ioutil.ReadFile(ServiceAccountToken)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(ServiceAccountCA)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{RootCAs: x509.NewCertPool()}
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+		return nil, errors.New("failed to parse service account CA certificate")
+	}
+	return &KubeAPI{
+		Host:   "https://" + net.JoinHostPort(host, port),
+		Token:  fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))),
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}, nil
+}
+
+// the subset of the kubeconfig file format used by the agent
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// creates a client using the current context of a kubeconfig file
+func newKubeAPIFromConfig(path string) (*KubeAPI, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(kubeConfig)
+	if err = yaml.Unmarshal(bytes, cfg); err != nil {
+		return nil, err
+	}
+	var clusterName, userName string
+	for _, ctx := range cfg.Contexts {
+		if ctx.Name == cfg.CurrentContext {
+			clusterName, userName = ctx.Context.Cluster, ctx.Context.User
+		}
+	}
+	if len(clusterName) == 0 {
+		return nil, fmt.Errorf("current context '%s' not found in kubeconfig %s", cfg.CurrentContext, path)
+	}
+	api := new(KubeAPI)
+	tlsConfig := new(tls.Config)
+	for _, cluster := range cfg.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		api.Host = cluster.Cluster.Server
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		ca, err := fileOrData(cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, err
+		}
+		if ca != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("failed to parse CA certificate for cluster '%s'", clusterName)
+			}
+		}
+	}
+	if len(api.Host) == 0 {
+		return nil, fmt.Errorf("cluster '%s' not found in kubeconfig %s", clusterName, path)
+	}
+	for _, user := range cfg.Users {
+		if user.Name != userName {
+			continue
+		}
+		if len(user.User.Token) > 0 {
+			api.Token = fmt.Sprintf("Bearer %s", user.User.Token)
+		} else if len(user.User.Username) > 0 {
+			api.Token = NewBasicToken(user.User.Username, user.User.Password)
+		}
+		cert, err := fileOrData(user.User.ClientCertificate, user.User.ClientCertificateData)
+		if err != nil {
+			return nil, err
+		}
+		key, err := fileOrData(user.User.ClientKey, user.User.ClientKeyData)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	api.client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return api, nil
+}
+
+// reads the content of a kubeconfig entry either from a file or from base64 encoded data
+func fileOrData(file string, data string) ([]byte, error) {
+	if len(data) > 0 {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if len(file) > 0 {
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// makes a GET request to the API server
+func (a *KubeAPI) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(GET, fmt.Sprintf("%s%s", a.Host, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Accept", "application/json")
+	if len(a.Token) > 0 {
+		req.Header.Set("Authorization", a.Token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusGone:
+			return nil, errResourceExpired
+		case http.StatusNotFound:
+			return nil, errResourceNotFound
+		}
+		return nil, fmt.Errorf("GET %s failed: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// lists all the objects under the passed-in resource path, a page at a time
+// returns the objects of all the pages and the resource version of the list
+func (a *KubeAPI) list(ctx context.Context, path string) (*kubeList, error) {
+	list := new(kubeList)
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(kubeListLimit))
+	for {
+		page, err := a.listPage(ctx, path, query)
+		if err != nil {
+			return nil, err
+		}
+		// all the pages are served from the snapshot taken for the first one
+		if len(list.Metadata.ResourceVersion) == 0 {
+			list.Metadata.ResourceVersion = page.Metadata.ResourceVersion
+		}
+		list.Items = append(list.Items, page.Items...)
+		if len(page.Metadata.Continue) == 0 {
+			return list, nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+// gets a single page of a list
+func (a *KubeAPI) listPage(ctx context.Context, path string, query url.Values) (*kubeList, error) {
+	resp, err := a.get(ctx, path, query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	page := new(kubeList)
+	err = json.NewDecoder(resp.Body).Decode(page)
+	return page, err
+}
+
+// watches the objects under the passed-in resource path starting from the specified resource version
+// and calls the handler for each event received, until the server closes the stream or an error occurs
+// returns the last resource version seen, so that the watch can be resumed
+func (a *KubeAPI) watch(ctx context.Context, path string, resourceVersion string, handler func(kubeWatchEvent) error) (string, error) {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("resourceVersion", resourceVersion)
+	resp, err := a.get(ctx, path, query)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := kubeWatchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			// the server closed the stream, the watch can be resumed
+			if ctx.Err() != nil || err == io.EOF {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+		if event.Type == "ERROR" {
+			status := kubeStatus{}
+			_ = json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return resourceVersion, errResourceExpired
+			}
+			return resourceVersion, fmt.Errorf("watch %s failed: %s", path, status.Message)
+		}
+		if event.Type != "BOOKMARK" {
+			if err := handler(event); err != nil {
+				return resourceVersion, err
+			}
+		}
+		resourceVersion = objectResourceVersion(event.Object)
+	}
+}
+
+// gets the resource version of a K8S object
+func objectResourceVersion(object json.RawMessage) string {
+	obj := struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}{}
+	_ = json.Unmarshal(object, &obj)
+	return obj.Metadata.ResourceVersion
+}
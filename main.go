@@ -14,10 +14,16 @@
 */
 package main
 
+import "os"
+
 /*
 	oxkube is an Onix CMDB agent which consume change events and updates the CMDB
 */
 func main() {
+	// runs the drift report command if requested (i.e. oxkube drift)
+	if len(os.Args) > 1 && os.Args[1] == "drift" {
+		os.Exit(drift(os.Args[2:]))
+	}
 	oxkube := OxKube{}
 	oxkube.start()
 }
@@ -0,0 +1,131 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// an in-memory fake of the Onix WAPI holding the items and links put by the client
+type memOnix struct {
+	sync.Mutex
+	items map[string]Item
+	links map[string]Link
+	// the types of the items queried
+	types []string
+}
+
+func newMemOnix() *memOnix {
+	return &memOnix{items: make(map[string]Item), links: make(map[string]Link)}
+}
+
+// starts a fake Onix WAPI returning a client connected to it and the function to stop it
+func (o *memOnix) start() (*Client, func()) {
+	srv := httptest.NewServer(o)
+	log := logrus.NewEntry(logrus.New())
+	return &Client{Log: log, Config: &Config{Onix: Onix{URL: srv.URL}}}, srv.Close
+}
+
+func (o *memOnix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.Lock()
+	defer o.Unlock()
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	resource, key := parts[0], ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	switch {
+	case r.Method == PUT && resource == "item":
+		item := Item{}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &item)
+		o.items[key] = item
+	case r.Method == PUT && resource == "link":
+		link := Link{}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &link)
+		o.links[key] = link
+	case r.Method == DELETE && resource == "item":
+		delete(o.items, key)
+	case r.Method == DELETE && resource == "link":
+		delete(o.links, key)
+	case r.Method == GET && resource == "item" && len(key) > 0:
+		item, ok := o.items[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(item)
+		return
+	case r.Method == GET && resource == "item":
+		o.types = append(o.types, r.URL.Query().Get("type"))
+		_ = json.NewEncoder(w).Encode(ResultList{Values: o.find(r)})
+		return
+	case r.Method == GET && resource == "link" && len(key) == 0:
+		list := LinkList{}
+		for _, link := range o.links {
+			if r.URL.Query().Get("startItemKey") == link.StartItemKey || r.URL.Query().Get("endItemKey") == link.EndItemKey {
+				list.Values = append(list.Values, link)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(`{"changed":true}`))
+}
+
+// finds the items matching the type and attribute filters of the passed-in query
+func (o *memOnix) find(r *http.Request) []Item {
+	var found []Item
+	query := r.URL.Query()
+	for _, item := range o.items {
+		if t := query.Get("type"); len(t) > 0 && item.Type != t {
+			continue
+		}
+		match := true
+		for _, filter := range strings.Split(query.Get("attrs"), "|") {
+			if pair := strings.SplitN(filter, ",", 2); len(pair) == 2 && item.Attribute[pair[0]] != pair[1] {
+				match = false
+			}
+		}
+		if match {
+			found = append(found, item)
+		}
+	}
+	return found
+}
+
+// the keys of the links ending in the passed-in item
+func (o *memOnix) linksTo(endItemKey string) []string {
+	o.Lock()
+	defer o.Unlock()
+	var keys []string
+	for key, link := range o.links {
+		if link.EndItemKey == endItemKey {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -37,15 +37,86 @@ func (k *OxKube) start() error {
 	if err != nil {
 		return err
 	}
+	// registers the handlers for the custom resources in the configuration
+	err = registerCustomResources(k.config.CustomResources)
+	if err != nil {
+		return err
+	}
 	// initialises the Onix REST client
 	k.client, err = NewClient(k.log, k.config)
 	if err != nil {
 		return err
 	}
+	// creates or updates the meta model for K8S in Onix
+	err = k.initModel()
+	if err != nil {
+		return err
+	}
+	// starts deleting the items retired for longer than the retention period
+	if k.config.Retirement.Enabled && k.config.Retirement.Retention > 0 {
+		go k.sweep()
+	}
+	// starts reconciling the CMDB with the objects in the cluster
+	if k.config.Reconcile.Enabled {
+		reconciler := &Reconciler{
+			log:    k.log,
+			config: k.config.Reconcile,
+		}
+		go reconciler.Start(k.client)
+	}
+	// the webhook is ready to receive incoming connections
+	k.ready = true
+	// start the configured consumer
+	switch k.config.Consumers.Consumer {
+	case "webhook":
+		k.log.Tracef("Webhook consumer has been selected.")
+		wh := Webhook{
+			log:    k.log,
+			config: k.config.Consumers.Webhook,
+			ready:  k.ready,
+		}
+		k.log.Tracef("Starting the webhook consumer.")
+		wh.Start(k.client)
+	case "broker":
+		k.log.Tracef("Broker consumer has been selected.")
+		broker := Broker{
+			log:    k.log,
+			config: k.config.Consumers.Broker,
+		}
+		k.log.Tracef("Starting the broker consumer.")
+		broker.Start(k.client)
+	case "kafka":
+		k.log.Tracef("Kafka consumer has been selected.")
+		kafka := Kafka{
+			log:    k.log,
+			config: k.config.Consumers.Kafka,
+		}
+		k.log.Tracef("Starting the kafka consumer.")
+		kafka.Start(k.client)
+	case "kube":
+		k.log.Tracef("Kube consumer has been selected.")
+		kube := Kube{
+			log:    k.log,
+			config: k.config.Consumers.Kube,
+		}
+		k.log.Tracef("Starting the kube consumer.")
+		kube.Start(k.client)
+	default:
+		k.log.Tracef("No consumer has been selected.")
+		panic(fmt.Sprintf("Mode '%s' is not implemented.", k.config.Consumers.Consumer))
+	}
+	return nil
+}
+
+// waits for Onix to be available and puts the meta model for K8S
+// the model is put even if it exists so that the item types and link rules added
+// since it was created (e.g. by an upgrade or custom resources) are recorded
+func (k *OxKube) initModel() error {
 	// checks if a meta model for K8S is defined in Onix
 	k.log.Tracef("Checking if the KUBE meta-model is defined in Onix.")
 	var (
 		exist    bool
+		err      error
 		attempts int
 		interval time.Duration = 30 // the interval to wait for reconnection
 	)
@@ -65,37 +136,19 @@ func (k *OxKube) start() error {
 			time.Sleep(interval * time.Second)
 		}
 	}
-	// if not...
-	if !exist {
-		// creates a meta model
-		k.log.Tracef("The KUBE meta-model is not yet defined in Onix, proceeding to create it.")
-		result := k.client.putModel()
-		if result.Error {
-			k.log.Errorf("Can't create KUBE meta-model: %s", result.Message)
-			return errors.New(result.Message)
-		}
+	if exist {
+		k.log.Tracef("KUBE meta-model found in Onix, proceeding to update it.")
 	} else {
-		k.log.Tracef("KUBE meta-model found in Onix.")
+		k.log.Tracef("The KUBE meta-model is not yet defined in Onix, proceeding to create it.")
 	}
-	// the webhook is ready to receive incoming connections
-	k.ready = true
-	// start the configured consumer
-	switch k.config.Consumers.Consumer {
-	case "webhook":
-		k.log.Tracef("Webhook consumer has been selected.")
-		wh := Webhook{
-			log:    k.log,
-			config: k.config.Consumers.Webhook,
-			ready:  k.ready,
+	// the put is idempotent so an existing model is left unchanged unless types are missing
+	result, err := k.client.putModel()
+	if check(result, err) {
+		if err == nil {
+			err = errors.New(result.Message)
 		}
-		k.log.Tracef("Starting the webhook consumer.")
-		wh.Start(k.client)
-	case "broker":
-		k.log.Tracef("Broker consumer has been selected.")
-		panic("Broker consumer is not implemented.")
-	default:
-		k.log.Tracef("No consumer has been selected.")
-		panic(fmt.Sprintf("Mode '%s' is not implemented.", k.config.Consumers.Consumer))
+		k.log.Errorf("Can't put KUBE meta-model: %s", err)
+		return err
 	}
 	return nil
 }
@@ -127,3 +180,20 @@ func (k *OxKube) loadConfig() error {
 	k.log.Infof("%s has been set as the logger level.", strings.ToUpper(c.LogLevel))
 	return nil
 }
+
+// periodically deletes the items retired for longer than the retention period
+func (k *OxKube) sweep() {
+	interval := k.config.Retirement.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		count, err := k.client.sweepRetired(k.config.Retirement.Retention)
+		if err != nil {
+			k.log.Errorf("Retention sweep failed: %s.", err)
+		} else {
+			k.log.Tracef("Retention sweep deleted %d retired items.", count)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// a fake Onix WAPI holding an existing K8S model and recording the model data put
+type fakeModelOnix struct {
+	data *Data
+}
+
+func (o *fakeModelOnix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == GET && r.URL.Path == "/model/"+K8SModel:
+		_, _ = w.Write([]byte(`{"key":"K8S","name":"Kubernetes"}`))
+	case r.Method == PUT && r.URL.Path == "/data":
+		body, _ := ioutil.ReadAll(r.Body)
+		o.data = new(Data)
+		_ = json.Unmarshal(body, o.data)
+		_, _ = w.Write([]byte(`{"changed":true,"operation":"U"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestInitModelUpdatesExistingModel(t *testing.T) {
+	onix := &fakeModelOnix{}
+	srv := httptest.NewServer(onix)
+	defer srv.Close()
+
+	log := logrus.NewEntry(logrus.New())
+	config := &Config{Onix: Onix{URL: srv.URL}}
+	k := &OxKube{config: config, log: log, client: &Client{Log: log, Config: config}}
+	if err := k.initModel(); err != nil {
+		t.Fatalf("failed to initialise the model: %s", err)
+	}
+	if onix.data == nil {
+		t.Fatalf("the model was not put as it already existed")
+	}
+	types := make(map[string]bool)
+	for _, itemType := range onix.data.ItemTypes {
+		types[itemType.Key] = true
+	}
+	for _, itemType := range []string{K8SDeployment, K8SReplicaSet, K8SStatefulSet, K8SDaemonSet, K8SJob, K8SCronJob, K8SContainer, K8SImage, K8SEndpoints} {
+		if !types[itemType] {
+			t.Errorf("item type %s was not put", itemType)
+		}
+	}
+	rules := make(map[string]bool)
+	for _, rule := range onix.data.LinkRules {
+		rules[rule.Key] = true
+	}
+	for _, rule := range []string{K8SReplicaSet + "->" + K8SDeployment, K8SContainer + "->" + K8SImage} {
+		if !rules[rule] {
+			t.Errorf("link rule %s was not put", rule)
+		}
+	}
+}
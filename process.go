@@ -0,0 +1,63 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
+// routes the event to the handler registered for the kind of K8S object
+// based on the type of change, this is shared by all event consumers
+func (c *Client) process(event []byte) (*Result, error) {
+	return c.dispatch(Handlers, event)
+}
+
+// routes the event to a handler in the passed-in registry
+func (c *Client) dispatch(registry *Registry, event []byte) (*Result, error) {
+	// get the kind of K8S object
+	chgKind := gjson.GetBytes(event, "Change.kind")
+	// get the type of change
+	chgType := gjson.GetBytes(event, "Change.type")
+
+	handler, ok := registry.Get(chgKind.String())
+	if !ok {
+		c.Log.Tracef("No handler registered for kind '%s'.", chgKind.String())
+		return nil, nil
+	}
+	switch strings.ToLower(chgType.String()) {
+	case "create":
+		return handler.Create(c, event)
+	case "update":
+		return handler.Update(c, event)
+	case "delete":
+		return handler.Delete(c, event)
+	}
+	return nil, nil
+}
+
+// describes the passed-in event for logging purposes without the K8S object,
+// which might hold sensitive data (e.g. the values of a secret)
+func describe(event []byte) string {
+	change := gjson.GetBytes(event, "Change")
+	return fmt.Sprintf("%s of %s '%s' in namespace '%s' of cluster '%s'",
+		change.Get("type").String(),
+		change.Get("kind").String(),
+		change.Get("name").String(),
+		change.Get("namespace").String(),
+		change.Get("host").String())
+}
@@ -0,0 +1,419 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the types of drift between the objects in a cluster and the items in the CMDB
+const (
+	// the object has no item in the CMDB
+	DriftMissing = "missing"
+	// the item differs from the object
+	DriftChanged = "changed"
+	// the item has no object in the cluster
+	DriftOrphaned = "orphaned"
+)
+
+// a difference between an object in the cluster and its item in the CMDB
+type Drift struct {
+	Type        string       `json:"type"`
+	Kind        string       `json:"kind"`
+	Key         string       `json:"key"`
+	Differences []Difference `json:"differences,omitempty"`
+	// the event fixing the drift: recording the object or deleting the orphaned item
+	event []byte
+}
+
+// a value of a changed item that differs from the object
+type Difference struct {
+	// the status, attribute.<name> or meta.<spec field>
+	Field   string `json:"field"`
+	CMDB    string `json:"cmdb"`
+	Cluster string `json:"cluster"`
+}
+
+// periodically reconciles the items in the CMDB with a full list of the objects in a cluster
+// taken from the API server or a Sentinel snapshot, fixing any drift caused by missed events
+type Reconciler struct {
+	log    *logrus.Entry
+	config ReconcileConf
+	ox     *Client
+	kube   *Kube
+	// only looks for orphaned items in the namespaces of the objects compared
+	// (e.g. read from a directory of manifests holding part of a cluster)
+	scoped bool
+}
+
+// launch the reconciliation loop
+func (r *Reconciler) Start(client *Client) {
+	r.ox = client
+	interval := r.config.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		if err := r.reconcile(context.Background()); err != nil {
+			r.log.Errorf("Reconciliation of cluster '%s' failed: %s.", r.config.Cluster, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// compares the objects in the cluster with the items in the CMDB and fixes the drift found
+func (r *Reconciler) reconcile(ctx context.Context) error {
+	objects, err := r.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	drifts, err := r.diff(objects)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]int)
+	fixed := 0
+	for _, drift := range drifts {
+		found[drift.Type]++
+		if err = r.fix(drift); err != nil {
+			r.log.Warnf("Failed to fix %s item %s: %s.", drift.Type, drift.Key, err)
+			continue
+		}
+		fixed++
+	}
+	r.log.Infof("Reconciliation of cluster '%s' found %d drifted items (%d missing, %d changed, %d orphaned) and fixed %d.",
+		r.config.Cluster, len(drifts), found[DriftMissing], found[DriftChanged], found[DriftOrphaned], fixed)
+	return nil
+}
+
+// records the object or deletes the orphaned item using the handler of its kind
+func (r *Reconciler) fix(drift Drift) error {
+	handler, ok := Handlers.Get(drift.Kind)
+	if !ok {
+		return fmt.Errorf("no handler registered for kind '%s'", drift.Kind)
+	}
+	var (
+		result *Result
+		err    error
+	)
+	if drift.Type == DriftOrphaned {
+		result, err = handler.Delete(r.ox, drift.event)
+	} else {
+		result, err = handler.Update(r.ox, drift.event)
+	}
+	if check(result, err) {
+		if err == nil {
+			err = errors.New(result.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// takes a full list of the objects in the cluster as Sentinel like events by kind of object
+// the kinds not listed (e.g. not served by the cluster) are not reconciled
+func (r *Reconciler) snapshot(ctx context.Context) (map[string][][]byte, error) {
+	switch r.config.Source {
+	case "", "kube":
+		return r.listCluster(ctx)
+	case "snapshot":
+		return readSnapshot(r.config.Snapshot, r.config.Cluster)
+	}
+	return nil, fmt.Errorf("reconciliation source '%s' is not implemented", r.config.Source)
+}
+
+// lists the objects of every resource watched by the kube consumer from the API server
+func (r *Reconciler) listCluster(ctx context.Context) (map[string][][]byte, error) {
+	if r.kube == nil {
+		api, err := NewKubeAPI(r.config.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		r.kube = &Kube{
+			log:    r.log,
+			config: KubeConf{Kubeconfig: r.config.Kubeconfig, Cluster: r.config.Cluster},
+			api:    api,
+		}
+	}
+	objects := make(map[string][][]byte)
+	for _, resource := range kubeResources {
+		list, err := r.kube.api.list(ctx, resource.path)
+		if err == errResourceNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		events := make([][]byte, 0, len(list.Items))
+		for _, object := range list.Items {
+			event, err := r.kube.newEvent(resource, "update", object)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		objects[resource.kind] = events
+	}
+	return objects, nil
+}
+
+// reads a Sentinel snapshot file holding a JSON array of events, keeping the events of the specified cluster
+func readSnapshot(path string, cluster string) (map[string][][]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []json.RawMessage
+	if err = json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %s", path, err)
+	}
+	objects := make(map[string][][]byte)
+	for _, event := range events {
+		if gjson.GetBytes(event, Cluster).String() != cluster ||
+			strings.ToLower(gjson.GetBytes(event, "Change.type").String()) == "delete" {
+			continue
+		}
+		kind := strings.ToLower(gjson.GetBytes(event, "Change.kind").String())
+		objects[kind] = append(objects[kind], event)
+	}
+	return objects, nil
+}
+
+// compares the passed-in objects with the items in the CMDB
+// returns the objects missing or changed and the items orphaned
+func (r *Reconciler) diff(objects map[string][][]byte) ([]Drift, error) {
+	var drifts []Drift
+	keys := make(map[string]bool)
+	namespaces := make(map[string]bool)
+	for _, resource := range kubeResources {
+		for _, event := range objects[resource.kind] {
+			key := resource.key(event)
+			keys[key] = true
+			if namespace := gjson.GetBytes(event, Namespace).String(); len(namespace) > 0 {
+				namespaces[namespace] = true
+			}
+			if resource.tag == "ns" {
+				namespaces[gjson.GetBytes(event, Key).String()] = true
+			}
+			item, err := r.ox.getItem(key)
+			if err != nil {
+				return nil, err
+			}
+			if item == nil || item.Status == StatusRetired {
+				drifts = append(drifts, Drift{Type: DriftMissing, Kind: resource.kind, Key: key, event: event})
+				continue
+			}
+			diffs, err := differences(resource, event, item)
+			if err != nil {
+				return nil, err
+			}
+			if len(diffs) > 0 {
+				drifts = append(drifts, Drift{Type: DriftChanged, Kind: resource.kind, Key: key, Differences: diffs, event: event})
+			}
+		}
+	}
+	// the namespaces recorded in the CMDB might also hold orphaned items
+	if !r.scoped {
+		recorded, err := r.ox.getObjectsOfType(r.config.Cluster, K8SNamespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range recorded {
+			namespaces[namespace.Name] = true
+		}
+	}
+	for _, resource := range kubeResources {
+		if _, listed := objects[resource.kind]; !listed {
+			continue
+		}
+		items, err := r.items(resource, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if keys[item.Key] || (r.scoped && resource.tag == "ns" && !namespaces[item.Name]) {
+				continue
+			}
+			keys[item.Key] = true
+			event, err := orphanEvent(r.config.Cluster, resource, item)
+			if err != nil {
+				return nil, err
+			}
+			drifts = append(drifts, Drift{Type: DriftOrphaned, Kind: resource.kind, Key: item.Key, event: event})
+		}
+	}
+	return drifts, nil
+}
+
+// compares the item recorded in the CMDB with the object in the passed-in event
+// the item is built as the handler of the kind of object builds it, and the attributes and meta
+// of both are compared, skipping the resource version, the creation time and the status
+// attributes if the object has none (e.g. exported manifests)
+func differences(resource kubeResource, event []byte, recorded *Item) ([]Difference, error) {
+	expected, err := resource.item(event)
+	if err != nil {
+		return nil, err
+	}
+	// the last applied configuration is not recorded for secrets
+	skipped := map[string]bool{"kubectl.kubernetes.io/last-applied-configuration": true}
+	if len(gjson.GetBytes(event, "Object.metadata.resourceVersion").String()) == 0 {
+		skipped["resourceVersion"] = true
+	}
+	if len(gjson.GetBytes(event, Created).String()) == 0 {
+		skipped["created"] = true
+	}
+	hasStatus := gjson.GetBytes(event, StatusInfo).Exists()
+	var diffs []Difference
+	if hasStatus && expected.Status != recorded.Status {
+		diffs = append(diffs, Difference{
+			Field:   "status",
+			CMDB:    strconv.Itoa(recorded.Status),
+			Cluster: strconv.Itoa(expected.Status),
+		})
+	}
+	// an attribute missing on one side is compared as empty, e.g. a label removed from the object
+	for _, name := range sortedKeys(expected.Attribute, recorded.Attribute) {
+		if skipped[name] || (!hasStatus && strings.HasPrefix(name, "status.")) {
+			continue
+		}
+		value, current := "", ""
+		if v, ok := expected.Attribute[name]; ok {
+			value = fmt.Sprint(v)
+		}
+		if v, ok := recorded.Attribute[name]; ok {
+			current = fmt.Sprint(v)
+		}
+		if current != value {
+			diffs = append(diffs, Difference{Field: fmt.Sprintf("attribute.%s", name), CMDB: current, Cluster: value})
+		}
+	}
+	for _, name := range sortedKeys(expected.Meta, recorded.Meta) {
+		value, err := json.Marshal(expected.Meta[name])
+		if err != nil {
+			return nil, err
+		}
+		current, err := json.Marshal(recorded.Meta[name])
+		if err != nil {
+			return nil, err
+		}
+		if string(current) != string(value) {
+			diffs = append(diffs, Difference{Field: fmt.Sprintf("meta.%s", name), CMDB: string(current), Cluster: string(value)})
+		}
+	}
+	return diffs, nil
+}
+
+// gets the keys of the passed-in maps in alphabetical order
+func sortedKeys(maps ...MAP) []string {
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			keys = appendUnique(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// gets the items recorded in the CMDB for the objects of the passed-in resource
+func (r *Reconciler) items(resource kubeResource, namespaces map[string]bool) ([]Item, error) {
+	var items []Item
+	if resource.tag == "ns" || clusterScoped[resource.tag] {
+		clusterItems, err := r.ox.getObjectsOfType(r.config.Cluster, resource.itemType)
+		if err != nil {
+			return nil, err
+		}
+		items = clusterItems
+	} else {
+		for namespace := range namespaces {
+			nsItems, err := r.ox.getObjectsInNamespace(r.config.Cluster, namespace, resource.itemType)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, nsItems...)
+		}
+	}
+	// different kinds of objects might be recorded with the same item type (e.g. ingresses and routes)
+	var result []Item
+	for _, item := range items {
+		namespace, _ := item.Attribute["namespace"].(string)
+		if strings.HasPrefix(item.Key, resource.keyPrefix(r.config.Cluster, namespace)) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// builds the item recorded for the object in the passed-in event
+func (r kubeResource) item(event []byte) (*Item, error) {
+	if build, ok := itemBuilders[r.kind]; ok {
+		return build(event)
+	}
+	return item(event, r.itemType.String(), r.tag)
+}
+
+// gets the key of the item recorded for the object in the passed-in event
+func (r kubeResource) key(event []byte) string {
+	if r.tag == "ns" {
+		return NS(event)
+	}
+	return itemKey(event, r.tag)
+}
+
+// gets the prefix of the keys of the items recorded for the objects of the resource in a namespace
+func (r kubeResource) keyPrefix(cluster string, namespace string) string {
+	if r.tag == "ns" {
+		return nsKey(cluster, "")
+	}
+	if clusterScoped[r.tag] {
+		return clusterItemKey(cluster, r.tag, "")
+	}
+	return fmt.Sprintf("%s-%s-", nsKey(cluster, namespace), r.tag)
+}
+
+// creates the event that Sentinel would have published for the deletion of the object of an orphaned item
+func orphanEvent(cluster string, resource kubeResource, item Item) ([]byte, error) {
+	namespace, _ := item.Attribute["namespace"].(string)
+	key := item.Name
+	if len(namespace) > 0 {
+		key = fmt.Sprintf("%s/%s", namespace, item.Name)
+	}
+	return json.Marshal(Event{
+		Change: StatusChange{
+			Key:       key,
+			Name:      item.Name,
+			Type:      "delete",
+			Namespace: namespace,
+			Kind:      resource.kind,
+			Time:      time.Now(),
+			Host:      cluster,
+		},
+		Object: MAP{
+			"metadata": MAP{"name": item.Name, "namespace": namespace},
+			"spec":     item.Meta,
+		},
+	})
+}
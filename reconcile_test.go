@@ -0,0 +1,134 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// an event for an object of the passed-in kind with the passed-in object fields
+func objectEvent(kind string, name string, object string) []byte {
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"%s","type":"create","name":"%s","namespace":"ns1","host":"test"},"Object":{"metadata":{"name":"%s"},%s}}`,
+		kind, name, name, object))
+}
+
+func TestDifferencesCompareTheItemsBuiltByTheHandlers(t *testing.T) {
+	crd := CustomResourceConf{Kind: "certificate", ItemType: "CERT", Tag: "cert",
+		Attributes: []CustomAttributeConf{{Name: "issuer", Path: "Object.spec.issuerRef.name"}}}
+	itemBuilders[crd.Kind] = customResourceItem(crd)
+	defer delete(itemBuilders, crd.Kind)
+
+	cases := []struct {
+		resource kubeResource
+		recorded string
+		current  string
+		field    string
+	}{
+		{kubeResource{kind: "config_map", itemType: K8SConfigMap, tag: ConfigMapNameTag},
+			`"data":{"a":"1"}`, `"data":{"a":"1","b":"2"}`, "attribute.keys"},
+		{kubeResource{kind: "secret", itemType: K8SSecret, tag: SecretNameTag},
+			`"type":"Opaque","data":{"a":""}`, `"type":"kubernetes.io/tls","data":{"a":""}`, "attribute.type"},
+		{kubeResource{kind: "ingress", itemType: K8SIngress, tag: IngressNameTag},
+			`"spec":{"rules":[{"host":"a.com"}]}`, `"spec":{"rules":[{"host":"b.com"}]}`, "attribute.hosts"},
+		{kubeResource{kind: "persistent_volume_claim", itemType: K8SPersistentVolumeClaim, tag: PersistentVolumeClaimNameTag},
+			`"spec":{"volumeName":"pv1"}`, `"spec":{"volumeName":"pv2"}`, "attribute.volumeName"},
+		{kubeResource{kind: "horizontal_pod_autoscaler", itemType: K8SAutoscaler, tag: AutoscalerNameTag},
+			`"spec":{"scaleTargetRef":{"kind":"Deployment","name":"web"}}`, `"spec":{"scaleTargetRef":{"kind":"Deployment","name":"api"}}`, "attribute.targetName"},
+		{kubeResource{kind: "network_policy", itemType: K8SNetworkPolicy, tag: NetworkPolicyNameTag},
+			`"spec":{"ingress":[{}]}`, `"spec":{"ingress":[{},{}]}`, "attribute.ingressRules"},
+		{kubeResource{kind: crd.Kind, itemType: K8SOBJ(crd.ItemType), tag: crd.Tag},
+			`"spec":{"issuerRef":{"name":"ca"}}`, `"spec":{"issuerRef":{"name":"acme"}}`, "attribute.issuer"},
+	}
+	for _, c := range cases {
+		recorded, err := c.resource.item(objectEvent(c.resource.kind, "obj", c.recorded))
+		if err != nil {
+			t.Fatalf("%s: failed to build the recorded item: %s", c.resource.kind, err)
+		}
+		diffs, err := differences(c.resource, objectEvent(c.resource.kind, "obj", c.recorded), recorded)
+		if err != nil || len(diffs) > 0 {
+			t.Errorf("%s: expected no differences with the recorded object, got %v %v", c.resource.kind, diffs, err)
+		}
+		diffs, err = differences(c.resource, objectEvent(c.resource.kind, "obj", c.current), recorded)
+		if err != nil {
+			t.Fatalf("%s: failed to compare the item: %s", c.resource.kind, err)
+		}
+		found := false
+		for _, diff := range diffs {
+			found = found || diff.Field == c.field
+		}
+		if !found {
+			t.Errorf("%s: expected a difference in %s, got %v", c.resource.kind, c.field, diffs)
+		}
+	}
+}
+
+func TestDifferencesSkipStatusAttributesOfObjectsWithoutStatus(t *testing.T) {
+	resource := kubeResource{kind: "job", itemType: K8SJob, tag: JobNameTag}
+	recorded, err := resource.item(objectEvent("job", "backup", `"spec":{"completions":1},"status":{"succeeded":1}`))
+	if err != nil {
+		t.Fatalf("failed to build the recorded item: %s", err)
+	}
+	diffs, err := differences(resource, objectEvent("job", "backup", `"spec":{"completions":1}`), recorded)
+	if err != nil || len(diffs) > 0 {
+		t.Errorf("expected no differences for a manifest without status, got %v %v", diffs, err)
+	}
+}
+
+func TestDifferencesReportRemovedLabelsAndClearedAttributes(t *testing.T) {
+	cases := []struct {
+		resource kubeResource
+		recorded string
+		current  string
+		field    string
+	}{
+		{kubeResource{kind: "config_map", itemType: K8SConfigMap, tag: ConfigMapNameTag},
+			`"metadata":{"name":"obj","labels":{"app":"web"}},"data":{"a":"1"}`, `"metadata":{"name":"obj"},"data":{"a":"1"}`, "attribute.app"},
+		{kubeResource{kind: "persistent_volume_claim", itemType: K8SPersistentVolumeClaim, tag: PersistentVolumeClaimNameTag},
+			`"spec":{"volumeName":"pv1"}`, `"spec":{"volumeName":""}`, "attribute.volumeName"},
+		{kubeResource{kind: "persistent_volume_claim", itemType: K8SPersistentVolumeClaim, tag: PersistentVolumeClaimNameTag},
+			`"spec":{"volumeName":"pv1"}`, `"spec":{}`, "meta.volumeName"},
+	}
+	for _, c := range cases {
+		recorded, err := c.resource.item(rawObjectEvent(c.resource.kind, c.recorded))
+		if err != nil {
+			t.Fatalf("%s: failed to build the recorded item: %s", c.resource.kind, err)
+		}
+		diffs, err := differences(c.resource, rawObjectEvent(c.resource.kind, c.current), recorded)
+		if err != nil {
+			t.Fatalf("%s: failed to compare the item: %s", c.resource.kind, err)
+		}
+		found := false
+		for _, diff := range diffs {
+			found = found || (diff.Field == c.field && (len(diff.Cluster) == 0 || diff.Cluster == "null"))
+		}
+		if !found {
+			t.Errorf("%s: expected %s to be reported as removed, got %v", c.resource.kind, c.field, diffs)
+		}
+	}
+}
+
+// an event for an object of the passed-in kind with the passed-in object fields, including its metadata
+func rawObjectEvent(kind string, object string) []byte {
+	if !strings.HasPrefix(object, `"metadata"`) {
+		object = `"metadata":{"name":"obj"},` + object
+	}
+	return []byte(fmt.Sprintf(
+		`{"Change":{"kind":"%s","type":"create","name":"obj","namespace":"ns1","host":"test"},"Object":{%s}}`,
+		kind, object))
+}
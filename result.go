@@ -36,6 +36,11 @@ func (list *ResultList) ToJSON() (*bytes.Reader, error) {
 	return GetJSONBytesReader(list)
 }
 
+// the links retrieved by a link query
+type LinkList struct {
+	Values []Link
+}
+
 // Check for errors in the result and the passed in error
 func (r *Result) Check(err error) error {
 	if err != nil {
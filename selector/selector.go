@@ -0,0 +1,188 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+// Package selector implements Kubernetes label selectors, so that the objects
+// selecting pods (e.g. services, network policies or disruption budgets)
+// can be linked with the pods they select
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the operators of a selector requirement
+const (
+	In           = "In"
+	NotIn        = "NotIn"
+	Exists       = "Exists"
+	DoesNotExist = "DoesNotExist"
+)
+
+// Labels gives access to the labels of an object
+type Labels interface {
+	// gets the value of the label and whether the object has it
+	Get(key string) (string, bool)
+}
+
+// Set is a map of label values implementing Labels
+type Set map[string]string
+
+func (s Set) Get(key string) (string, bool) {
+	value, ok := s[key]
+	return value, ok
+}
+
+// Requirement is a selector expression (e.g. tier In (web, db))
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Selector matches the objects having all its labels and meeting all its requirements
+// an empty selector matches all objects
+type Selector struct {
+	MatchLabels      map[string]string
+	MatchExpressions []Requirement
+}
+
+// creates a selector from an equality based selector (e.g. the selector of a service)
+func FromSet(set map[string]interface{}) *Selector {
+	s := &Selector{MatchLabels: make(map[string]string)}
+	for key, value := range set {
+		s.MatchLabels[key] = fmt.Sprintf("%v", value)
+	}
+	return s
+}
+
+// creates a selector from a label selector with matchLabels and matchExpressions
+// (e.g. the pod selector of a network policy) as unmarshalled from JSON
+func Parse(labelSelector map[string]interface{}) (*Selector, error) {
+	s := &Selector{MatchLabels: make(map[string]string)}
+	if matchLabels, ok := labelSelector["matchLabels"].(map[string]interface{}); ok {
+		s = FromSet(matchLabels)
+	}
+	expressions, _ := labelSelector["matchExpressions"].([]interface{})
+	for _, expression := range expressions {
+		exp, ok := expression.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid selector expression: %v", expression)
+		}
+		r := Requirement{}
+		r.Key, _ = exp["key"].(string)
+		r.Operator, _ = exp["operator"].(string)
+		values, _ := exp["values"].([]interface{})
+		for _, value := range values {
+			r.Values = append(r.Values, fmt.Sprintf("%v", value))
+		}
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		s.MatchExpressions = append(s.MatchExpressions, r)
+	}
+	return s, nil
+}
+
+// checks the requirement can be evaluated
+func (r Requirement) validate() error {
+	if len(r.Key) == 0 {
+		return errors.New("selector expression requires a key")
+	}
+	switch r.Operator {
+	case In, NotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("selector expression on '%s' requires values for operator %s", r.Key, r.Operator)
+		}
+	case Exists, DoesNotExist:
+		if len(r.Values) > 0 {
+			return fmt.Errorf("selector expression on '%s' does not allow values for operator %s", r.Key, r.Operator)
+		}
+	default:
+		return fmt.Errorf("selector expression on '%s' has an invalid operator '%s'", r.Key, r.Operator)
+	}
+	return nil
+}
+
+// checks if the requirement holds for the passed-in labels
+func (r Requirement) Matches(labels Labels) bool {
+	value, exists := labels.Get(r.Key)
+	switch r.Operator {
+	case In:
+		return exists && contains(r.Values, value)
+	case NotIn:
+		// an object without the label meets a NotIn requirement
+		return !exists || !contains(r.Values, value)
+	case Exists:
+		return exists
+	case DoesNotExist:
+		return !exists
+	}
+	return false
+}
+
+// checks if the passed-in labels have all the selector labels and meet all its requirements
+func (s *Selector) Matches(labels Labels) bool {
+	for key, value := range s.MatchLabels {
+		if v, ok := labels.Get(key); !ok || v != value {
+			return false
+		}
+	}
+	for _, r := range s.MatchExpressions {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// checks if the selector matches all objects
+func (s *Selector) Empty() bool {
+	return len(s.MatchLabels) == 0 && len(s.MatchExpressions) == 0
+}
+
+// gets the selector in the K8S string format (e.g. app=web,tier in (db))
+func (s *Selector) String() string {
+	var parts, keys []string
+	for key := range s.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", key, s.MatchLabels[key]))
+	}
+	for _, r := range s.MatchExpressions {
+		switch r.Operator {
+		case In, NotIn:
+			parts = append(parts, fmt.Sprintf("%s %s (%s)", r.Key, strings.ToLower(r.Operator), strings.Join(r.Values, ",")))
+		case Exists:
+			parts = append(parts, r.Key)
+		case DoesNotExist:
+			parts = append(parts, fmt.Sprintf("!%s", r.Key))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+/*
+   Onix Kube - Copyright (c) 2019 by www.gatblau.org
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software distributed under
+   the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+   either express or implied.
+   See the License for the specific language governing permissions and limitations under the License.
+
+   Contributors to this project, hereby assign copyright in this code to the project,
+   to be licensed under the same terms as the rest of the code.
+*/
+
+package selector
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// parses a label selector from its JSON representation
+func parse(t *testing.T, labelSelector string) *Selector {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(labelSelector), &m); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Parse(m)
+	if err != nil {
+		t.Fatalf("failed to parse selector %s: %s", labelSelector, err)
+	}
+	return s
+}
+
+func TestMatchLabelsRequiresAllLabels(t *testing.T) {
+	s := FromSet(map[string]interface{}{"app": "web", "tier": "db"})
+	cases := []struct {
+		labels Set
+		match  bool
+	}{
+		{Set{"app": "web", "tier": "db"}, true},
+		{Set{"app": "web", "tier": "db", "env": "prod"}, true},
+		{Set{"app": "web"}, false},
+		{Set{"app": "web", "tier": "frontend"}, false},
+		{Set{}, false},
+	}
+	for _, c := range cases {
+		if s.Matches(c.labels) != c.match {
+			t.Errorf("expected selector %s to match %v: %t", s, c.labels, c.match)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	cases := []struct {
+		selector string
+		labels   Set
+		match    bool
+	}{
+		{`{"matchExpressions":[{"key":"tier","operator":"In","values":["web","db"]}]}`, Set{"tier": "db"}, true},
+		{`{"matchExpressions":[{"key":"tier","operator":"In","values":["web","db"]}]}`, Set{"tier": "cache"}, false},
+		{`{"matchExpressions":[{"key":"tier","operator":"In","values":["web","db"]}]}`, Set{}, false},
+		{`{"matchExpressions":[{"key":"env","operator":"NotIn","values":["dev"]}]}`, Set{"env": "prod"}, true},
+		{`{"matchExpressions":[{"key":"env","operator":"NotIn","values":["dev"]}]}`, Set{"env": "dev"}, false},
+		{`{"matchExpressions":[{"key":"env","operator":"NotIn","values":["dev"]}]}`, Set{}, true},
+		{`{"matchExpressions":[{"key":"canary","operator":"Exists"}]}`, Set{"canary": ""}, true},
+		{`{"matchExpressions":[{"key":"canary","operator":"Exists"}]}`, Set{}, false},
+		{`{"matchExpressions":[{"key":"canary","operator":"DoesNotExist"}]}`, Set{}, true},
+		{`{"matchExpressions":[{"key":"canary","operator":"DoesNotExist"}]}`, Set{"canary": "true"}, false},
+		{`{"matchLabels":{"app":"web"},"matchExpressions":[{"key":"env","operator":"In","values":["prod"]}]}`, Set{"app": "web", "env": "prod"}, true},
+		{`{"matchLabels":{"app":"web"},"matchExpressions":[{"key":"env","operator":"In","values":["prod"]}]}`, Set{"app": "api", "env": "prod"}, false},
+		{`{"matchLabels":{"app":"web"},"matchExpressions":[{"key":"env","operator":"In","values":["prod"]}]}`, Set{"app": "web", "env": "dev"}, false},
+	}
+	for _, c := range cases {
+		if parse(t, c.selector).Matches(c.labels) != c.match {
+			t.Errorf("expected selector %s to match %v: %t", c.selector, c.labels, c.match)
+		}
+	}
+}
+
+func TestEmptySelectorMatchesAll(t *testing.T) {
+	s := parse(t, `{}`)
+	if !s.Empty() {
+		t.Errorf("expected selector to be empty")
+	}
+	if !s.Matches(Set{"app": "web"}) || !s.Matches(Set{}) {
+		t.Errorf("expected empty selector to match all labels")
+	}
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	invalid := []string{
+		`{"matchExpressions":[{"key":"tier","operator":"In"}]}`,
+		`{"matchExpressions":[{"key":"tier","operator":"Exists","values":["web"]}]}`,
+		`{"matchExpressions":[{"key":"tier","operator":"Equals","values":["web"]}]}`,
+		`{"matchExpressions":[{"operator":"Exists"}]}`,
+	}
+	for _, selector := range invalid {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(selector), &m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Parse(m); err == nil {
+			t.Errorf("expected selector %s to be rejected", selector)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	s := parse(t, `{"matchLabels":{"tier":"db","app":"web"},"matchExpressions":[{"key":"env","operator":"NotIn","values":["dev","test"]},{"key":"canary","operator":"DoesNotExist"}]}`)
+	expected := "app=web,tier=db,env notin (dev,test),!canary"
+	if s.String() != expected {
+		t.Errorf("expected %s, got %s", expected, s.String())
+	}
+}
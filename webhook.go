@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
-	"github.com/tidwall/gjson"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -121,7 +120,7 @@ func (c *Webhook) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	c.log.Tracef("request: %s", event)
+	c.log.Tracef("request: %s", describe(event))
 
 	// if basic auth enabled
 	if strings.ToLower(c.config.AuthMode) == "basic" {
@@ -163,7 +162,7 @@ func (c *Webhook) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		// protective code instead process does not return a result
 		if result == nil {
-			c.log.Error("No result whilst processing request to %s with payload %s", r.URL.Path, r.Body)
+			c.log.Errorf("No result whilst processing request to %s for %s", r.URL.Path, describe(event))
 			return
 		}
 		if result.Error {
@@ -201,78 +200,9 @@ func (c *Webhook) rootHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// process the event using the dispatch shared by all consumers
 func (c *Webhook) process(event []byte) (*Result, error) {
-	// get the kind of K8S object
-	chgKind := gjson.GetBytes(event, "Change.kind")
-	// get the type of change
-	chgType := gjson.GetBytes(event, "Change.type")
-
-	switch strings.ToLower(chgKind.String()) {
-	case "namespace":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putNamespace(event)
-		case "delete":
-			return c.ox.deleteResource("item", NS(event))
-		}
-	case "pod":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putPod(event)
-		case "delete":
-			return c.ox.deleteResource("item", itemKey(event, PodNameTag))
-		}
-	case "service":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putService(event)
-		case "delete":
-			return c.ox.deleteResource("item", itemKey(event, ServiceNameTag))
-		}
-	case "persistent_volume_claim":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putPersistentVolumeClaim(event)
-		case "delete":
-			return c.ox.deleteResource("item", itemKey(event, PersistentVolumeClaimNameTag))
-		}
-	case "replication_controller":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putReplicationController(event)
-		case "delete":
-			return c.ox.deleteResource("item", itemKey(event, ReplicationControllerNameTag))
-		}
-	case "ingress":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			fallthrough
-		case "delete":
-			c.log.Trace("ingress recording not implemented")
-		}
-	case "resourcequota":
-		switch strings.ToLower(chgType.String()) {
-		case "create":
-			fallthrough
-		case "update":
-			return c.ox.putResourceQuota(event)
-		case "delete":
-			return c.ox.deleteResource("item", itemKey(event, ResourceQuotaNameTag))
-		}
-	}
-	return nil, nil
+	return c.ox.process(event)
 }
 
 // unmarshal the http request into a json like structure